@@ -9,6 +9,7 @@ import (
 // This is useful if we want to keep the data for some time after its expired or if we need to share the expiration
 // with other instances that access the same cache.
 type cachedValue struct {
+	CreatedAt  time.Time
 	FreshUntil time.Time
 	Value      json.RawMessage
 }
@@ -19,8 +20,10 @@ func newCachedValue(value interface{}, duration time.Duration) (cachedValue, err
 		return cachedValue{}, err
 	}
 
+	now := time.Now()
 	return cachedValue{
-		FreshUntil: time.Now().Add(duration),
+		CreatedAt:  now,
+		FreshUntil: now.Add(duration),
 		Value:      json.RawMessage(bytes),
 	}, nil
 }
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/reflext"
+)
+
+const (
+	encryptedCacheLogCategory = "encrypted_cache"
+)
+
+// Keyring holds the AES keys used for encrypting cache values. Values are always
+// encrypted with the current key, and the ID of the key is saved together with
+// them so they can still be decrypted after the current key is rotated, as long
+// as the previous key is kept in the keyring.
+type Keyring interface {
+	Current() (id string, aead cipher.AEAD)
+	Get(id string) (aead cipher.AEAD, ok bool)
+}
+
+// NewKeyring creates a keyring from AES keys indexed by their IDs. Keys must be
+// 16, 24 or 32 bytes long, for AES-128, AES-192 or AES-256 respectively.
+func NewKeyring(currentID string, keys map[string][]byte) (Keyring, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, errors.Errorf("Current key %s not found in keyring", currentID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid AES key %s", id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create GCM cipher for key %s", id)
+		}
+		aeads[id] = aead
+	}
+	return &keyring{currentID: currentID, aeads: aeads}, nil
+}
+
+type keyring struct {
+	currentID string
+	aeads     map[string]cipher.AEAD
+}
+
+func (k *keyring) Current() (string, cipher.AEAD) {
+	return k.currentID, k.aeads[k.currentID]
+}
+
+func (k *keyring) Get(id string) (cipher.AEAD, bool) {
+	aead, ok := k.aeads[id]
+	return aead, ok
+}
+
+type EncryptedOptions struct {
+	// KeyHashSecret, if set, is used to replace the cache keys by their HMAC so
+	// that the keys sent to the underlying cache don't disclose any data either.
+	KeyHashSecret []byte
+}
+
+// Encrypted returns a cache that encrypts values with AES-GCM before handing
+// them to the underlying cache, e.g. a Redis cache or the remote tier of a
+// Hybrid one. The cache key is authenticated together with the value, so an
+// encrypted value is only valid for the key it was saved with.
+func Encrypted(c Cache, keys Keyring) Cache {
+	return EncryptedWithOptions(c, keys, EncryptedOptions{})
+}
+
+func EncryptedWithOptions(c Cache, keys Keyring, opts EncryptedOptions) Cache {
+	return &encryptedCache{cache: c, keys: keys, keyHashSecret: opts.KeyHashSecret}
+}
+
+type encryptedCache struct {
+	cache         Cache
+	keys          Keyring
+	keyHashSecret []byte
+}
+
+// encryptedValue is the payload actually saved in the underlying cache.
+type encryptedValue struct {
+	KeyID string
+	Nonce []byte
+	Data  []byte
+}
+
+func (c *encryptedCache) Get(key string, result interface{}) (bool, error) {
+	if err := ensureValidCacheKey(key); err != nil {
+		return false, err
+	}
+
+	var encrypted encryptedValue
+	cached, err := c.cache.Get(c.storageKey(key), &encrypted)
+	if err != nil || !cached {
+		return false, err
+	}
+
+	aead, ok := c.keys.Get(encrypted.KeyID)
+	if !ok {
+		return false, errors.Errorf("Unknown encryption key %s for cache key %s", encrypted.KeyID, key)
+	}
+	plaintext, err := aead.Open(nil, encrypted.Nonce, encrypted.Data, []byte(key))
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to decrypt cached value")
+	}
+
+	if err := json.Unmarshal(plaintext, result); err != nil {
+		return false, errors.Wrapf(err, "Unable to save decrypted data in result variable")
+	}
+	return true, nil
+}
+
+func (c *encryptedCache) Set(key string, value interface{}, duration time.Duration) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize value for encryption")
+	}
+
+	keyID, aead := c.keys.Current()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrapf(err, "Failed to generate encryption nonce")
+	}
+
+	encrypted := encryptedValue{
+		KeyID: keyID,
+		Nonce: nonce,
+		Data:  aead.Seal(nil, nonce, plaintext, []byte(key)),
+	}
+	return c.cache.Set(c.storageKey(key), encrypted, duration)
+}
+
+func (c *encryptedCache) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+
+	cached, err := c.Get(key, result)
+	if err != nil {
+		// We log the error, but still try to get fresh data to avoid disrupting a workflow that might still work.
+		logEncryptedGetError(key, err)
+	} else if cached {
+		return nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	c.Set(key, value, duration)
+	return reflext.SetPointer(result, value)
+}
+
+func (c *encryptedCache) storageKey(key string) string {
+	if c.keyHashSecret == nil {
+		return key
+	}
+	mac := hmac.New(sha256.New, c.keyHashSecret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func logEncryptedGetError(key string, err error) {
+	logger(encryptedCacheLogCategory, "get_error", key).
+		WithError(err).
+		Error("Failed to get data from encrypted cache")
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+)
+
+func TestEncryptedCache(t *testing.T) {
+	store := NewFakeCache()
+	duration := 5 * time.Minute
+	expectedErr := errors.New("I am expected")
+
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	keys, err := NewKeyring("old", map[string][]byte{"old": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := Encrypted(store, keys)
+
+	Convey("Keyring", t, func() {
+		Convey("It should reject invalid keys", func() {
+			_, err := NewKeyring("k", map[string][]byte{"k": []byte("short")})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should require the current key", func() {
+			_, err := NewKeyring("missing", map[string][]byte{"k": oldKey})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Encrypted", t, func() {
+		key := "encrypted_cache"
+
+		store.Reset()
+
+		value := 1000 + rand.Intn(100)
+
+		Convey("It should return decrypted data", func() {
+			So(subject.Set(key, value, duration), ShouldBeNil)
+
+			GetCacheHit(subject.Get, key, value)
+			So(store.SetMustHaveBeenCalledWith(key, Any, duration), ShouldBeNil)
+		})
+
+		Convey("It should not store plaintext data", func() {
+			So(subject.Set(key, value, duration), ShouldBeNil)
+
+			var stored encryptedValue
+			_, err := store.Get(key, &stored)
+			So(err, ShouldBeNil)
+			So(stored.KeyID, ShouldEqual, "old")
+			So(bytes.Contains(stored.Data, []byte(strconv.Itoa(value))), ShouldBeFalse)
+		})
+
+		Convey("It should miss if data is not present", func() {
+			GetCacheMiss(subject.Get, key)
+		})
+
+		Convey("It should fail to decrypt values moved to other keys", func() {
+			So(subject.Set(key, value, duration), ShouldBeNil)
+
+			var stored encryptedValue
+			store.Get(key, &stored)
+			store.Populate("other_key", stored, duration)
+
+			GetCacheError(subject.Get, "other_key")
+		})
+
+		Convey("It should decrypt values from rotated keys", func() {
+			So(subject.Set(key, value, duration), ShouldBeNil)
+
+			rotated, err := NewKeyring("new", map[string][]byte{"old": oldKey, "new": newKey})
+			So(err, ShouldBeNil)
+			rotatedSubject := Encrypted(store, rotated)
+			GetCacheHit(rotatedSubject.Get, key, value)
+
+			So(rotatedSubject.Set(key, value, duration), ShouldBeNil)
+			GetCacheHit(rotatedSubject.Get, key, value)
+			GetCacheError(subject.Get, key)
+		})
+
+		Convey("It should hash keys when configured", func() {
+			hashed := EncryptedWithOptions(store, keys, EncryptedOptions{KeyHashSecret: []byte("secret")})
+			So(hashed.Set(key, value, duration), ShouldBeNil)
+
+			GetCacheHit(hashed.Get, key, value)
+			So(store.SetMustNotHaveBeenCalledWith(key, Any, Any), ShouldBeNil)
+		})
+
+		Convey("It should fetch data on GetOrSet misses", func() {
+			GetOrSetFetch(subject.GetOrSet, key, duration, value)
+			GetOrSetCached(subject.GetOrSet, key, duration, value)
+		})
+
+		Convey("It should forward fetch errors", func() {
+			GetOrSetError(subject.GetOrSet, key, duration, expectedErr)
+		})
+
+		Convey("It should work as the remote tier of a hybrid cache", func() {
+			local := NewFakeCache()
+			hybrid := Hybrid(local, subject)
+			So(hybrid.Set(key, value, duration), ShouldBeNil)
+			local.DeleteKey(key)
+
+			GetCacheHit(hybrid.Get, key, value)
+		})
+	})
+}
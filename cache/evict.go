@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"encoding/json"
+)
+
+// EvictReason tells why an entry left a cache.
+type EvictReason int
+
+const (
+	// EvictExpired is used for entries removed after their duration elapsed.
+	// Notice expired entries are removed periodically, not as soon as they
+	// expire.
+	EvictExpired EvictReason = iota
+	// EvictCapacity is used for entries removed to make room for new ones.
+	EvictCapacity
+	// EvictDeleted is used for entries removed explicitly with Delete.
+	EvictDeleted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// EvictFunc is called with the key and value of entries leaving a cache. It is
+// not called for entries overwritten by Set. It must not block, since it runs
+// synchronously with the operation that evicted the entry.
+type EvictFunc func(key string, value interface{}, reason EvictReason)
+
+// EvictNotifier is implemented by caches which can notify when entries are
+// evicted from them.
+type EvictNotifier interface {
+	OnEvict(f EvictFunc)
+}
+
+// Deleter is implemented by caches supporting the explicit removal of entries.
+type Deleter interface {
+	Delete(key string) error
+}
+
+// OnEvict registers f to be called when entries are evicted from the cache, if
+// it implements EvictNotifier, returning whether it does.
+func OnEvict(c Cache, f EvictFunc) bool {
+	notifier, ok := c.(EvictNotifier)
+	if ok {
+		notifier.OnEvict(f)
+	}
+	return ok
+}
+
+// OnEvict is best-effort: it only works when the local cache implements
+// EvictNotifier, and since the local cache only holds the JSON form of entries,
+// f receives values as json.RawMessage. The remote cache is not watched.
+func (c *hybridCache) OnEvict(f EvictFunc) {
+	OnEvict(c.local, func(key string, value interface{}, reason EvictReason) {
+		f(key, localValue(value), reason)
+	})
+}
+
+// localValue extracts the JSON of the value from a cachedValue evicted from the
+// local tier of a hybrid cache, returning the given value if it is not one.
+func localValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case cachedValue:
+		return v.Value
+	case []byte:
+		// Local caches with JSON isolation
+		var local cachedValue
+		if err := json.Unmarshal(v, &local); err == nil && local.Value != nil {
+			return local.Value
+		}
+		return json.RawMessage(v)
+	}
+	return value
+}
@@ -22,15 +22,27 @@ type hybridCache struct {
 }
 
 func (c *hybridCache) Get(key string, result interface{}) (bool, error) {
-	var jsonValue json.RawMessage
-	cached, localErr := c.local.Get(key, &jsonValue)
+	info, err := c.get(key, result)
+	return info.Hit, err
+}
+
+// GetWithInfo works like Get, also reporting which tier served the entry.
+func (c *hybridCache) GetWithInfo(key string, result interface{}) (Info, error) {
+	return c.get(key, result)
+}
+
+// get reads the entry from the local cache, which holds the same cachedValue
+// as the remote one, falling back to the remote cache.
+func (c *hybridCache) get(key string, result interface{}) (Info, error) {
+	var localData cachedValue
+	cached, localErr := c.local.Get(key, &localData)
 	if localErr != nil {
 		// Log, but fall back to remote cache to try to avoid disrupting the request.
 		logGetLocalDataError(key, false, localErr)
 	} else if cached {
-		localErr = json.Unmarshal(jsonValue, result)
+		localErr = json.Unmarshal(localData.Value, result)
 		if localErr == nil {
-			return true, nil
+			return localData.info(TierLocal), nil
 		}
 		logGetLocalDataError(key, true, localErr)
 	}
@@ -38,23 +50,23 @@ func (c *hybridCache) Get(key string, result interface{}) (bool, error) {
 	var remoteData cachedValue
 	cached, err := c.remote.Get(key, &remoteData)
 	if err != nil {
-		return false, errors.Wrapf(err, "Unable to fetch data from remote cache")
+		return Info{}, errors.Wrapf(err, "Unable to fetch data from remote cache")
 	}
 
 	if !cached {
-		return false, localErr
+		return Info{}, localErr
 	}
 
 	err = json.Unmarshal(remoteData.Value, result)
 	if err != nil {
-		return false, errors.Wrapf(err, "Unable to save retrieved data in result variable")
+		return Info{}, errors.Wrapf(err, "Unable to save retrieved data in result variable")
 	}
 
 	// This if accounts for possible clock differences, ensuring we never write to local cache with a negative duration.
 	if ttl := remoteData.TTL(); ttl > 0 {
-		c.local.Set(key, remoteData.Value, ttl)
+		c.local.Set(key, remoteData, ttl)
 	}
-	return true, nil
+	return remoteData.info(TierRemote), nil
 }
 
 func (c *hybridCache) Set(key string, value interface{}, duration time.Duration) error {
@@ -67,7 +79,7 @@ func (c *hybridCache) Set(key string, value interface{}, duration time.Duration)
 		return errors.Wrapf(err, "Failed to save data into cache")
 	}
 
-	err = c.local.Set(key, remoteData.Value, duration)
+	err = c.local.Set(key, remoteData, duration)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to save data into local cache")
 	}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"encoding/json"
 	"errors"
 	"math/rand"
 	"testing"
@@ -113,6 +114,52 @@ func TestHybridCache(t *testing.T) {
 		})
 	})
 
+	Convey("GetWithInfo", t, func() {
+		key := "test_hybrid_cache_get_with_info"
+
+		local.Reset()
+		remote.Reset()
+
+		value := rand.Intn(100)
+		informer := subject.(Informer)
+
+		Convey("It should report local tier when served from local cache", func() {
+			subject.Set(key, value, duration)
+
+			var data int
+			info, err := informer.GetWithInfo(key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Hit, ShouldBeTrue)
+			So(info.Stale, ShouldBeFalse)
+			So(info.Tier, ShouldEqual, TierLocal)
+			So(info.FreshUntil, ShouldHappenWithin, time.Second, time.Now().Add(duration))
+		})
+
+		Convey("It should report remote tier when served from remote cache", func() {
+			subject.Set(key, value, duration)
+			local.DeleteKey(key)
+
+			var data int
+			info, err := informer.GetWithInfo(key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Hit, ShouldBeTrue)
+			So(info.Tier, ShouldEqual, TierRemote)
+
+			info, err = informer.GetWithInfo(key, &data)
+			So(err, ShouldBeNil)
+			So(info.Tier, ShouldEqual, TierLocal)
+		})
+
+		Convey("It should report a miss when both caches miss", func() {
+			var data int
+			info, err := informer.GetWithInfo(key, &data)
+			So(err, ShouldBeNil)
+			So(info.Hit, ShouldBeFalse)
+		})
+	})
+
 	Convey("Set", t, func() {
 		key := "test_hybrid_cache_set"
 		value := 16
@@ -126,6 +173,17 @@ func TestHybridCache(t *testing.T) {
 			So(local.SetMustHaveBeenCalledWith(key, Any, duration), ShouldBeNil)
 		})
 
+		Convey("It should save the value with its information in a single local entry", func() {
+			So(subject.Set(key, value, duration), ShouldBeNil)
+
+			var localData cachedValue
+			cached, err := local.Get(key, &localData)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(string(localData.Value), ShouldEqual, "16")
+			So(localData.FreshUntil, ShouldHappenWithin, time.Second, time.Now().Add(duration))
+		})
+
 		Convey("It should set remote cache", func() {
 			So(subject.Set(key, value, duration), ShouldBeNil)
 
@@ -205,4 +263,28 @@ func TestHybridCache(t *testing.T) {
 			GetOrSetError(subject.GetOrSet, key, duration, fetchErr)
 		})
 	})
+	Convey("OnEvict", t, func() {
+		key := "hybrid_evict"
+
+		Convey("It should report the JSON of values evicted from local cache", func() {
+			memory := NewMemory()
+			subject := Hybrid(memory, NewFakeCache())
+
+			var evictedKey string
+			var evictedValue interface{}
+			So(OnEvict(subject, func(key string, value interface{}, reason EvictReason) {
+				evictedKey, evictedValue = key, value
+			}), ShouldBeTrue)
+
+			So(subject.Set(key, []int{1, 2}, duration), ShouldBeNil)
+			So(memory.(Deleter).Delete(key), ShouldBeNil)
+			So(evictedKey, ShouldEqual, key)
+			So(evictedValue, ShouldResemble, json.RawMessage(`[1,2]`))
+		})
+
+		Convey("It should do nothing if local cache does not support it", func() {
+			So(OnEvict(NewFakeCache(), func(string, interface{}, EvictReason) {}), ShouldBeFalse)
+			So(OnEvict(subject, func(string, interface{}, EvictReason) {}), ShouldBeTrue)
+		})
+	})
 }
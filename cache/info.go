@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"time"
+)
+
+// Tier identifies which layer of a multi-layer cache served an entry.
+type Tier string
+
+const (
+	TierUnknown Tier = ""
+	TierLocal   Tier = "local"
+	TierRemote  Tier = "remote"
+)
+
+// Info describes the cache entry that was used to answer a Get, so callers can
+// make decisions about it (e.g. setting Age and Warning HTTP headers).
+type Info struct {
+	Hit        bool
+	Stale      bool
+	FreshUntil time.Time
+	Age        time.Duration
+	Tier       Tier
+}
+
+// Informer is optionally implemented by caches which are able to describe the
+// entries they return. Use GetWithInfo to call it on any cache.
+type Informer interface {
+	GetWithInfo(key string, result interface{}) (Info, error)
+}
+
+// GetWithInfo gets the value for key from the cache, returning the entry
+// information when the cache implements Informer. For other caches only the
+// Hit field is filled in.
+func GetWithInfo(c Cache, key string, result interface{}) (Info, error) {
+	if informer, ok := c.(Informer); ok {
+		return informer.GetWithInfo(key, result)
+	}
+
+	hit, err := c.Get(key, result)
+	return Info{Hit: hit}, err
+}
+
+func (c cachedValue) info(tier Tier) Info {
+	info := Info{
+		Hit:        true,
+		Stale:      c.TTL() <= 0,
+		FreshUntil: c.FreshUntil,
+		Tier:       tier,
+	}
+	if !c.CreatedAt.IsZero() {
+		info.Age = time.Since(c.CreatedAt)
+	}
+	return info
+}
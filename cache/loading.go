@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/reflext"
+	"github.com/vtex/go-io/sharedflight"
+)
+
+const (
+	loadingCacheLogCategory = "loading_cache"
+)
+
+// LoaderFunc loads the value for a single key.
+type LoaderFunc func(ctx context.Context, key string) (interface{}, error)
+
+// BulkLoaderFunc loads the values for many keys at once. Keys missing from the
+// returned map are treated as not found.
+type BulkLoaderFunc func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// Loading is a cache which knows how to load its own values, so that callers
+// don't need to pass a closure on every call like with GetOrSet. This avoids
+// accidentally capturing references (e.g. to the current request) in the cache
+// and centralizes how values are loaded.
+//
+// Concurrent loads of the same key are coalesced into a single call to the
+// loader, which is only cancelled when all callers waiting for it are done.
+type Loading interface {
+	// Get returns the cached value for key, loading it on misses.
+	Get(ctx context.Context, key string, result interface{}) error
+	// GetAll gets the values for many keys into results, which must be a pointer
+	// to a map with string keys. Missing keys are loaded with the bulk loader if
+	// there is one, or otherwise one by one.
+	GetAll(ctx context.Context, keys []string, results interface{}) error
+	// Refresh loads the value for key regardless of it being cached, replacing
+	// the cached value.
+	Refresh(ctx context.Context, key string) error
+}
+
+func NewLoading(c Cache, loader LoaderFunc, ttl time.Duration) Loading {
+	return &loadingCache{cache: c, loader: loader, ttl: ttl}
+}
+
+// NewBulkLoading creates a Loading cache which loads values in bulk, including
+// single keys on Get.
+func NewBulkLoading(c Cache, bulkLoader BulkLoaderFunc, ttl time.Duration) Loading {
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		values, err := bulkLoader(ctx, []string{key})
+		if err != nil {
+			return nil, err
+		}
+		value, ok := values[key]
+		if !ok {
+			return nil, errors.Errorf("Bulk loader did not return a value for key %s", key)
+		}
+		return value, nil
+	}
+	return &loadingCache{cache: c, loader: loader, bulkLoader: bulkLoader, ttl: ttl}
+}
+
+type loadingCache struct {
+	cache      Cache
+	loader     LoaderFunc
+	bulkLoader BulkLoaderFunc
+	ttl        time.Duration
+
+	flight sharedflight.Group
+
+	// inflight holds the keys being loaded, either by a single or a bulk load,
+	// so that both kinds of loads wait for each other instead of loading the
+	// same key twice.
+	inflightMu sync.Mutex
+	inflight   map[string]*inflightLoad
+}
+
+type inflightLoad struct {
+	done  chan struct{}
+	value interface{}
+	found bool
+	err   error
+}
+
+func (c *loadingCache) Get(ctx context.Context, key string, result interface{}) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+
+	cached, err := c.cache.Get(key, result)
+	if err != nil {
+		// Log and continue since we can still load fresh data.
+		logLoadingGetError(key, err)
+	} else if cached {
+		return nil
+	}
+
+	value, err := c.load(ctx, key)
+	if err != nil {
+		return err
+	}
+	return reflext.SetPointer(result, value)
+}
+
+func (c *loadingCache) GetAll(ctx context.Context, keys []string, results interface{}) error {
+	mapRv := reflect.ValueOf(results)
+	if mapRv.Kind() != reflect.Ptr || mapRv.Elem().Kind() != reflect.Map || mapRv.Elem().Type().Key().Kind() != reflect.String {
+		return errors.Errorf("Results must be a pointer to a map with string keys, got %T", results)
+	}
+	mapRv = mapRv.Elem()
+	if mapRv.IsNil() {
+		mapRv.Set(reflect.MakeMap(mapRv.Type()))
+	}
+	keyType, elemType := mapRv.Type().Key(), mapRv.Type().Elem()
+
+	missing := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if err := ensureValidCacheKey(key); err != nil {
+			return err
+		}
+
+		elemPtr := reflect.New(elemType)
+		cached, err := c.cache.Get(key, elemPtr.Interface())
+		if err != nil {
+			logLoadingGetError(key, err)
+		}
+		if err == nil && cached {
+			mapRv.SetMapIndex(reflect.ValueOf(key).Convert(keyType), elemPtr.Elem())
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	values, err := c.loadAll(ctx, missing)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		elemPtr := reflect.New(elemType)
+		if err := reflext.SetPointer(elemPtr.Interface(), value); err != nil {
+			return errors.Wrapf(err, "Failed to set loaded value for key %s", key)
+		}
+		mapRv.SetMapIndex(reflect.ValueOf(key).Convert(keyType), elemPtr.Elem())
+	}
+	return nil
+}
+
+func (c *loadingCache) Refresh(ctx context.Context, key string) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+
+	_, err := c.load(ctx, key)
+	return err
+}
+
+func (c *loadingCache) load(ctx context.Context, key string) (interface{}, error) {
+	value, err, _ := c.flight.Do(key, ctx, func(ctx context.Context) (value interface{}, err error) {
+		claimed, joined := c.claim([]string{key})
+		if len(joined) > 0 {
+			// Loaded by a bulk load.
+			load := joined[key]
+			if err := waitLoad(ctx, load); err != nil {
+				return nil, err
+			} else if !load.found {
+				return nil, errors.Errorf("Bulk loader did not return a value for key %s", key)
+			}
+			return load.value, nil
+		}
+
+		defer func() {
+			c.finish(claimed, map[string]interface{}{key: value}, err)
+		}()
+
+		value, err = c.loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.cache.Set(key, value, c.ttl); err != nil {
+			logLoadingSetError(key, err)
+		}
+		return value, nil
+	})
+	return value, err
+}
+
+// loadAll loads many keys with the bulk loader, except for those that are
+// already being loaded, for which it waits instead. Keys not found are left out.
+func (c *loadingCache) loadAll(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	if c.bulkLoader == nil {
+		values := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			value, err := c.load(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	claimed, joined := c.claim(keys)
+	values := map[string]interface{}{}
+	if len(claimed) > 0 {
+		claimedKeys := make([]string, 0, len(claimed))
+		for _, key := range keys {
+			if claimed[key] != nil {
+				claimedKeys = append(claimedKeys, key)
+			}
+		}
+
+		loaded, err := c.bulkLoad(ctx, claimed, claimedKeys)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range loaded {
+			if err := c.cache.Set(key, value, c.ttl); err != nil {
+				logLoadingSetError(key, err)
+			}
+			values[key] = value
+		}
+	}
+
+	for key, load := range joined {
+		if err := waitLoad(ctx, load); err != nil {
+			return nil, err
+		} else if load.found {
+			values[key] = load.value
+		}
+	}
+	return values, nil
+}
+
+func (c *loadingCache) bulkLoad(ctx context.Context, claimed map[string]*inflightLoad, keys []string) (values map[string]interface{}, err error) {
+	defer func() {
+		c.finish(claimed, values, err)
+	}()
+	return c.bulkLoader(ctx, keys)
+}
+
+// claim registers the keys not being loaded yet as in flight, returning them
+// apart from those already being loaded.
+func (c *loadingCache) claim(keys []string) (claimed, joined map[string]*inflightLoad) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	if c.inflight == nil {
+		c.inflight = map[string]*inflightLoad{}
+	}
+
+	claimed, joined = map[string]*inflightLoad{}, map[string]*inflightLoad{}
+	for _, key := range keys {
+		if load, ok := c.inflight[key]; ok {
+			joined[key] = load
+		} else if claimed[key] == nil {
+			load := &inflightLoad{done: make(chan struct{})}
+			c.inflight[key] = load
+			claimed[key] = load
+		}
+	}
+	return claimed, joined
+}
+
+// finish records the results of the claimed loads, waking up their waiters.
+func (c *loadingCache) finish(claimed map[string]*inflightLoad, values map[string]interface{}, err error) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	for key, load := range claimed {
+		load.value, load.found = values[key]
+		load.err = err
+		delete(c.inflight, key)
+		close(load.done)
+	}
+}
+
+func waitLoad(ctx context.Context, load *inflightLoad) error {
+	select {
+	case <-load.done:
+		return load.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func logLoadingGetError(key string, err error) {
+	logger(loadingCacheLogCategory, "get_error", key).
+		WithError(err).
+		Error("Failed to get data from cache")
+}
+
+func logLoadingSetError(key string, err error) {
+	logger(loadingCacheLogCategory, "set_error", key).
+		WithError(err).
+		Error("Failed to save loaded data into cache")
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+)
+
+func TestLoadingCache(t *testing.T) {
+	store := NewFakeCache()
+	ttl := 5 * time.Minute
+	ctx := context.Background()
+	expectedErr := errors.New("I am expected")
+
+	Convey("Loading", t, func() {
+		key := "loading_cache"
+
+		store.Reset()
+
+		value := rand.Intn(100)
+		loads := 0
+		subject := NewLoading(store, func(ctx context.Context, key string) (interface{}, error) {
+			loads++
+			return value, nil
+		}, ttl)
+
+		Convey("It should load and cache values on misses", func() {
+			var data int
+			So(subject.Get(ctx, key, &data), ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(store.SetMustHaveBeenCalledWith(key, value, ttl), ShouldBeNil)
+
+			data = -1
+			So(subject.Get(ctx, key, &data), ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(loads, ShouldEqual, 1)
+		})
+
+		Convey("It should forward loader errors", func() {
+			failing := NewLoading(store, func(ctx context.Context, key string) (interface{}, error) {
+				return nil, expectedErr
+			}, ttl)
+
+			var data int
+			So(errors.Cause(failing.Get(ctx, key, &data)), ShouldEqual, expectedErr)
+		})
+
+		Convey("It should reload on Refresh", func() {
+			var data int
+			So(subject.Get(ctx, key, &data), ShouldBeNil)
+			So(subject.Refresh(ctx, key), ShouldBeNil)
+			So(loads, ShouldEqual, 2)
+		})
+
+		Convey("It should get many keys, loading only the missing ones", func() {
+			store.Populate("cached", value, ttl)
+
+			results := map[string]int{}
+			So(subject.GetAll(ctx, []string{"cached", key}, &results), ShouldBeNil)
+			So(results, ShouldResemble, map[string]int{"cached": value, key: value})
+			So(loads, ShouldEqual, 1)
+		})
+
+		Convey("It should convert values into results for GetAll like Get does", func() {
+			results := map[string]float64{}
+			So(subject.GetAll(ctx, []string{key}, &results), ShouldBeNil)
+			So(results, ShouldResemble, map[string]float64{key: float64(value)})
+		})
+
+		Convey("It should reject invalid results for GetAll", func() {
+			var results []int
+			So(subject.GetAll(ctx, []string{key}, &results), ShouldNotBeNil)
+		})
+	})
+
+	Convey("BulkLoading", t, func() {
+		store.Reset()
+
+		var requested [][]string
+		subject := NewBulkLoading(store, func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			requested = append(requested, keys)
+			values := map[string]interface{}{}
+			for _, key := range keys {
+				if key != "missing" {
+					values[key] = len(key)
+				}
+			}
+			return values, nil
+		}, ttl)
+
+		Convey("It should load missing keys in a single call", func() {
+			store.Populate("cached", 0, ttl)
+
+			var results map[string]int
+			So(subject.GetAll(ctx, []string{"cached", "a", "bb", "missing"}, &results), ShouldBeNil)
+			So(results, ShouldResemble, map[string]int{"cached": 0, "a": 1, "bb": 2})
+			So(requested, ShouldResemble, [][]string{{"a", "bb", "missing"}})
+		})
+
+		Convey("It should not load keys already being loaded by Get", func() {
+			started, release := make(chan struct{}), make(chan struct{})
+			blocking := NewBulkLoading(NewMemory(), func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+				requested = append(requested, keys)
+				if keys[0] == "a" {
+					close(started)
+					<-release
+				}
+				return map[string]interface{}{keys[0]: len(keys[0])}, nil
+			}, ttl)
+
+			got := make(chan error)
+			go func() { got <- blocking.Get(ctx, "a", new(int)) }()
+			<-started
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				close(release)
+			}()
+
+			var results map[string]int
+			So(blocking.GetAll(ctx, []string{"a", "bb"}, &results), ShouldBeNil)
+			So(results, ShouldResemble, map[string]int{"a": 1, "bb": 2})
+			So(requested, ShouldResemble, [][]string{{"a"}, {"bb"}})
+			So(<-got, ShouldBeNil)
+		})
+
+		Convey("It should use the bulk loader for single keys", func() {
+			var data int
+			So(subject.Get(ctx, "abc", &data), ShouldBeNil)
+			So(data, ShouldEqual, 3)
+
+			So(subject.Get(ctx, "missing", &data), ShouldNotBeNil)
+		})
+	})
+}
@@ -1,18 +1,112 @@
 package cache
 
 import (
+	"container/list"
+	"encoding/json"
+	"runtime"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	gocache "github.com/pmylund/go-cache"
 	"github.com/vtex/go-io/reflext"
 )
 
+const (
+	defaultMemoryExpiration      = 60 * time.Minute
+	defaultMemoryCleanupInterval = 10 * time.Minute
+)
+
+// Isolation defines how values stored in the memory cache are isolated from
+// the ones handed to and received from callers.
+type Isolation int
+
+const (
+	// IsolationNone stores and returns the exact values given to Set, so callers
+	// mutating a returned slice or map also mutate the cached value. It is the
+	// fastest option.
+	IsolationNone Isolation = iota
+	// IsolationJSON stores values in their JSON form and decodes an independent
+	// copy on every Get. Values must be JSON serializable. According to the
+	// benchmarks in memoryCache_test.go, a Get of a small struct is about 10x
+	// slower than with IsolationNone and makes several more allocations.
+	IsolationJSON
+	// IsolationDeepCopy stores a deep copy of values (see reflext.DeepCopy) and
+	// returns another copy on every Get. Unlike IsolationJSON, it keeps values of
+	// types that are not JSON serializable, like interfaces and unexported
+	// fields, though the latter are shared with the cached value. Its Get costs
+	// about as much as with IsolationJSON.
+	IsolationDeepCopy
+)
+
+type MemoryOptions struct {
+	// Isolation defaults to IsolationNone, since most cached values are treated
+	// as read-only and the copying overhead would be paid on every Get.
+	Isolation Isolation
+	// MaxEntries limits the number of entries in the cache, evicting the least
+	// recently set entries when exceeded. Defaults to 0, meaning no limit.
+	MaxEntries int
+}
+
 func NewMemory() Cache {
-	return &memCache{gocache.New(60*time.Minute, 10*time.Minute)}
+	return NewMemoryWithOptions(MemoryOptions{})
+}
+
+func NewMemoryWithOptions(opts MemoryOptions) Cache {
+	c := &memCache{
+		// Expired entries are deleted by the janitor of the memCache instead of
+		// the underlying cache, so that all evictions happen with the lock held.
+		cache:      gocache.New(defaultMemoryExpiration, 0),
+		isolation:  opts.Isolation,
+		maxEntries: opts.MaxEntries,
+		removing:   map[string]EvictReason{},
+	}
+	if c.maxEntries > 0 {
+		c.order = list.New()
+		c.elements = map[string]*list.Element{}
+	}
+	c.cache.OnEvicted(c.evicted)
+
+	// As in go-cache, the janitor doesn't reference the returned value, so that
+	// it can be garbage collected, stopping the janitor.
+	stop := make(chan struct{})
+	go c.runJanitor(defaultMemoryCleanupInterval, stop)
+	ref := &memCacheRef{c}
+	runtime.SetFinalizer(ref, func(*memCacheRef) { close(stop) })
+	return ref
+}
+
+// memCacheRef is the memCache handed to callers, whose finalizer stops the
+// janitor.
+type memCacheRef struct {
+	*memCache
 }
 
 type memCache struct {
-	cache *gocache.Cache
+	cache     *gocache.Cache
+	isolation Isolation
+
+	// mu guards the underlying cache writes together with the fields below, so
+	// that the tracking of entries always matches the underlying cache.
+	mu      sync.Mutex
+	onEvict []EvictFunc
+	// removing has the reasons for entries being removed by the memCache itself,
+	// since the underlying cache only reports expirations and deletions alike.
+	removing map[string]EvictReason
+	// evictions are the entries evicted with the lock held, whose callbacks are
+	// called once it's released.
+	evictions []eviction
+
+	// Used when limiting the number of entries, ordered by their last Set.
+	maxEntries int
+	order      *list.List
+	elements   map[string]*list.Element
+}
+
+type eviction struct {
+	key    string
+	value  interface{}
+	reason EvictReason
 }
 
 func (c *memCache) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
@@ -39,10 +133,128 @@ func (c *memCache) Get(key string, result interface{}) (bool, error) {
 		return false, nil
 	}
 
+	switch c.isolation {
+	case IsolationJSON:
+		return true, json.Unmarshal(value.([]byte), result)
+	case IsolationDeepCopy:
+		return true, reflext.DeepCopy(result, value)
+	}
 	return true, reflext.SetPointer(result, value)
 }
 
 func (c *memCache) Set(key string, value interface{}, duration time.Duration) error {
+	switch c.isolation {
+	case IsolationJSON:
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to serialize value for memory cache")
+		}
+		value = bytes
+	case IsolationDeepCopy:
+		var copied interface{}
+		if err := reflext.DeepCopy(&copied, value); err != nil {
+			return errors.Wrapf(err, "Failed to copy value for memory cache")
+		}
+		value = copied
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
 	c.cache.Set(key, value, duration)
+	if c.maxEntries > 0 {
+		c.trackSet(key)
+	}
+	return nil
+}
+
+// Delete removes the entry for key, if any, calling the eviction callbacks.
+func (c *memCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.unlock()
+	c.remove(key, EvictDeleted)
 	return nil
 }
+
+// OnEvict registers f to be called whenever an entry is evicted. Values are
+// passed as stored, so they are JSON encoded with IsolationJSON.
+func (c *memCache) OnEvict(f EvictFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEvict = append(c.onEvict, f)
+}
+
+func (c *memCache) runJanitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.deleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *memCache) deleteExpired() {
+	c.mu.Lock()
+	defer c.unlock()
+	c.cache.DeleteExpired()
+}
+
+// unlock releases the lock and then calls the callbacks for the entries evicted
+// while it was held, so that callbacks are free to use the cache.
+func (c *memCache) unlock() {
+	evictions, callbacks := c.evictions, c.onEvict
+	c.evictions = nil
+	c.mu.Unlock()
+
+	for _, e := range evictions {
+		value := e.value
+		if c.isolation == IsolationJSON {
+			value = json.RawMessage(value.([]byte))
+		}
+		for _, f := range callbacks {
+			f(e.key, value, e.reason)
+		}
+	}
+}
+
+// trackSet must be called with the lock held.
+func (c *memCache) trackSet(key string) {
+	if elem, ok := c.elements[key]; ok {
+		c.order.MoveToBack(elem)
+	} else {
+		c.elements[key] = c.order.PushBack(key)
+	}
+
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Front().Value.(string), EvictCapacity)
+	}
+}
+
+// remove must be called with the lock held.
+func (c *memCache) remove(key string, reason EvictReason) {
+	c.removing[key] = reason
+	// Calls c.evicted synchronously if the entry exists.
+	c.cache.Delete(key)
+	delete(c.removing, key)
+	c.untrack(key)
+}
+
+// evicted is called by the underlying cache, always with the lock held.
+func (c *memCache) evicted(key string, value interface{}) {
+	reason, ok := c.removing[key]
+	if !ok {
+		reason = EvictExpired
+	}
+	c.untrack(key)
+	c.evictions = append(c.evictions, eviction{key, value, reason})
+}
+
+func (c *memCache) untrack(key string) {
+	if elem, ok := c.elements[key]; ok {
+		c.order.Remove(elem)
+		delete(c.elements, key)
+	}
+}
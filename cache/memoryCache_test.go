@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+)
+
+type memoryCacheTestValue struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+}
+
+func newMemoryCacheTestValue() memoryCacheTestValue {
+	return memoryCacheTestValue{
+		Name:  "value",
+		Tags:  []string{"a", "b", "c"},
+		Attrs: map[string]int{"x": 1, "y": 2},
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	duration := 5 * time.Minute
+
+	Convey("Memory cache", t, func() {
+		key := "memory_cache"
+		value := rand.Intn(100)
+
+		for _, isolation := range []Isolation{IsolationNone, IsolationJSON, IsolationDeepCopy} {
+			subject := NewMemoryWithOptions(MemoryOptions{Isolation: isolation})
+
+			So(subject.Set(key, value, duration), ShouldBeNil)
+			GetCacheHit(subject.Get, key, value)
+			GetCacheMiss(subject.Get, "memory_cache_missing")
+			GetOrSetCached(subject.GetOrSet, key, duration, value)
+			GetOrSetFetch(subject.GetOrSet, "memory_cache_fetch", duration, value)
+		}
+
+		Convey("It should share values without isolation", func() {
+			subject := NewMemory()
+			So(subject.Set(key, newMemoryCacheTestValue(), duration), ShouldBeNil)
+
+			var result memoryCacheTestValue
+			_, err := subject.Get(key, &result)
+			So(err, ShouldBeNil)
+			result.Tags[0] = "mutated"
+
+			var other memoryCacheTestValue
+			subject.Get(key, &other)
+			So(other.Tags[0], ShouldEqual, "mutated")
+		})
+
+		Convey("It should return independent copies with JSON isolation", func() {
+			subject := NewMemoryWithOptions(MemoryOptions{Isolation: IsolationJSON})
+			So(subject.Set(key, newMemoryCacheTestValue(), duration), ShouldBeNil)
+
+			var result memoryCacheTestValue
+			_, err := subject.Get(key, &result)
+			So(err, ShouldBeNil)
+			result.Tags[0] = "mutated"
+			result.Attrs["x"] = 100
+
+			var other memoryCacheTestValue
+			subject.Get(key, &other)
+			So(other, ShouldResemble, newMemoryCacheTestValue())
+		})
+
+		Convey("It should return independent copies with deep copy isolation", func() {
+			subject := NewMemoryWithOptions(MemoryOptions{Isolation: IsolationDeepCopy})
+			stored := newMemoryCacheTestValue()
+			So(subject.Set(key, &stored, duration), ShouldBeNil)
+			stored.Name = "mutated"
+
+			var result *memoryCacheTestValue
+			_, err := subject.Get(key, &result)
+			So(err, ShouldBeNil)
+			So(*result, ShouldResemble, newMemoryCacheTestValue())
+			result.Tags[0] = "mutated"
+			result.Attrs["x"] = 100
+
+			var other memoryCacheTestValue
+			subject.Get(key, &other)
+			So(other, ShouldResemble, newMemoryCacheTestValue())
+		})
+
+		Convey("It should call eviction callbacks", func() {
+			subject := NewMemoryWithOptions(MemoryOptions{MaxEntries: 2})
+			evicted := map[string]EvictReason{}
+			So(OnEvict(subject, func(key string, value interface{}, reason EvictReason) {
+				So(value, ShouldEqual, key+"_value")
+				evicted[key] = reason
+			}), ShouldBeTrue)
+
+			subject.Set("a", "a_value", duration)
+			subject.Set("b", "b_value", time.Nanosecond)
+			subject.Set("c", "c_value", duration)
+			So(evicted, ShouldResemble, map[string]EvictReason{"a": EvictCapacity})
+
+			time.Sleep(time.Millisecond)
+			subject.(*memCacheRef).deleteExpired()
+			So(evicted["b"], ShouldEqual, EvictExpired)
+
+			So(subject.(Deleter).Delete("c"), ShouldBeNil)
+			So(evicted["c"], ShouldEqual, EvictDeleted)
+			So(len(evicted), ShouldEqual, 3)
+		})
+
+		Convey("It should evict the least recently set entries", func() {
+			subject := NewMemoryWithOptions(MemoryOptions{MaxEntries: 2})
+			subject.Set("a", 1, duration)
+			subject.Set("b", 2, duration)
+			subject.Set("a", 3, duration)
+			subject.Set("c", 4, duration)
+
+			GetCacheHit(subject.Get, "a", 3)
+			GetCacheMiss(subject.Get, "b")
+			GetCacheHit(subject.Get, "c", 4)
+		})
+
+		Convey("It should track the entries set and deleted concurrently", func() {
+			subject := NewMemoryWithOptions(MemoryOptions{MaxEntries: 3})
+			var evictions int64
+			OnEvict(subject, func(key string, value interface{}, reason EvictReason) {
+				atomic.AddInt64(&evictions, 1)
+			})
+
+			var wg sync.WaitGroup
+			for i := 0; i < 16; i++ {
+				wg.Add(1)
+				go func(seed int64) {
+					defer wg.Done()
+					r := rand.New(rand.NewSource(seed))
+					for j := 0; j < 5000; j++ {
+						key := strconv.Itoa(r.Intn(5))
+						if r.Intn(3) == 0 {
+							subject.(Deleter).Delete(key)
+						} else {
+							subject.Set(key, j, duration)
+						}
+					}
+				}(int64(i))
+			}
+			wg.Wait()
+
+			c := subject.(*memCacheRef).memCache
+			So(c.order.Len(), ShouldBeLessThanOrEqualTo, 3)
+			So(c.order.Len(), ShouldEqual, c.cache.ItemCount())
+			for key := range c.elements {
+				_, cached := c.cache.Get(key)
+				So(cached, ShouldBeTrue)
+			}
+			So(atomic.LoadInt64(&evictions), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("It should fail to set unserializable values with JSON isolation", func() {
+			subject := NewMemoryWithOptions(MemoryOptions{Isolation: IsolationJSON})
+			So(subject.Set(key, func() {}, duration), ShouldNotBeNil)
+		})
+	})
+}
+
+func BenchmarkMemoryCacheGet(b *testing.B) {
+	benchmarks := []struct {
+		name      string
+		isolation Isolation
+	}{
+		{"None", IsolationNone},
+		{"JSON", IsolationJSON},
+		{"DeepCopy", IsolationDeepCopy},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			subject := NewMemoryWithOptions(MemoryOptions{Isolation: bm.isolation})
+			subject.Set("key", newMemoryCacheTestValue(), time.Hour)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var result memoryCacheTestValue
+				subject.Get("key", &result)
+			}
+		})
+	}
+}
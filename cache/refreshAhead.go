@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/reflext"
+	"github.com/vtex/go-io/sharedflight"
+)
+
+const (
+	refreshAheadLogCategory = "refresh_ahead_cache"
+
+	defaultRefreshCheckInterval = 1 * time.Second
+	defaultRefreshIdleExpiry    = 1 * time.Hour
+	defaultRefreshMinBackoff    = 1 * time.Second
+	defaultRefreshMaxBackoff    = 1 * time.Minute
+)
+
+// RefreshAhead keeps registered keys always warm by refreshing them in the
+// background before they stop being fresh. If a refresh fails, the previous
+// value keeps being served (like WithStaleFallback does) and the refresh is
+// retried with exponential backoff.
+type RefreshAhead interface {
+	// Register starts refreshing the key in the background with the given loader,
+	// caching values for ttl. Registering an existing key replaces its loader.
+	Register(key string, ttl time.Duration, loader func() (interface{}, error)) error
+	// Unregister stops refreshing the key. The cached value is kept.
+	Unregister(key string)
+	// Get returns the latest value for the key, fresh or not. If a registered
+	// key is not found in the storage, it is loaded synchronously.
+	Get(key string, result interface{}) (hit bool, err error)
+	// Stop stops the background refreshing of all keys.
+	Stop()
+}
+
+type RefreshAheadOptions struct {
+	// RefreshBefore is how long before the value stops being fresh it should be
+	// refreshed. Defaults to a tenth of the TTL of each key.
+	RefreshBefore time.Duration
+	// IdleExpiry is for how long a key can go without being read before its
+	// registration expires.
+	IdleExpiry time.Duration
+	// CheckInterval is how often the registered keys are checked for refreshing.
+	CheckInterval time.Duration
+	// MinBackoff and MaxBackoff are the bounds for the interval between retries
+	// of failed refreshes.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+func NewRefreshAhead(storage Stale, opts RefreshAheadOptions) RefreshAhead {
+	if opts.IdleExpiry <= 0 {
+		opts.IdleExpiry = defaultRefreshIdleExpiry
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultRefreshCheckInterval
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultRefreshMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = maxDuration(defaultRefreshMaxBackoff, opts.MinBackoff)
+	}
+
+	r := &refreshAhead{
+		storage: storage,
+		opts:    opts,
+		entries: map[string]*refreshEntry{},
+		done:    make(chan struct{}),
+	}
+	go r.refreshLoop()
+	return r
+}
+
+type refreshAhead struct {
+	storage Stale
+	opts    RefreshAheadOptions
+
+	mu      sync.RWMutex
+	entries map[string]*refreshEntry
+	// flight coalesces the background refreshes and the loads on cold Gets.
+	flight sharedflight.Group
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+type refreshEntry struct {
+	key    string
+	ttl    time.Duration
+	loader func() (interface{}, error)
+
+	mu          sync.Mutex
+	freshUntil  time.Time
+	lastRead    time.Time
+	nextAttempt time.Time
+	failures    int
+	// refreshing is set while a refresh is in progress, so that a slow loader
+	// is not called again by later refresh rounds.
+	refreshing bool
+}
+
+func (r *refreshAhead) Register(key string, ttl time.Duration, loader func() (interface{}, error)) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return errors.Errorf("Refresh ahead TTL must be positive (key: %s)", key)
+	}
+
+	entry := &refreshEntry{key: key, ttl: ttl, loader: loader, lastRead: time.Now()}
+
+	var ignored interface{}
+	if info, err := GetWithInfo(r.storage, key, &ignored); err == nil && info.Hit {
+		entry.freshUntil = info.FreshUntil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[key] = entry
+	return nil
+}
+
+func (r *refreshAhead) Unregister(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, key)
+}
+
+func (r *refreshAhead) Get(key string, result interface{}) (bool, error) {
+	entry := r.entry(key)
+	if entry != nil {
+		entry.mu.Lock()
+		entry.lastRead = time.Now()
+		entry.mu.Unlock()
+	}
+
+	cached, err := r.storage.GetStale(key, result)
+	if err != nil || cached || entry == nil {
+		return cached, err
+	}
+
+	value, err := r.refresh(entry)
+	if err != nil {
+		return false, err
+	}
+	return true, reflext.SetPointer(result, value)
+}
+
+func (r *refreshAhead) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *refreshAhead) entry(key string) *refreshEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entries[key]
+}
+
+func (r *refreshAhead) refreshLoop() {
+	ticker := time.NewTicker(r.opts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refreshDue(time.Now())
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// refreshDue expires idle registrations and starts concurrently refreshing all
+// entries that are due and not being refreshed already. It doesn't wait for the
+// refreshes, so that a hung loader doesn't hold the refreshes of other keys,
+// but returns a WaitGroup that is done when they finish.
+func (r *refreshAhead) refreshDue(now time.Time) *sync.WaitGroup {
+	r.mu.Lock()
+	due := make([]*refreshEntry, 0, len(r.entries))
+	for key, entry := range r.entries {
+		entry.mu.Lock()
+		idle := now.Sub(entry.lastRead) > r.opts.IdleExpiry
+		shouldRefresh := !entry.refreshing && !now.Before(entry.nextAttempt) && !now.Before(entry.freshUntil.Add(-r.refreshBefore(entry)))
+		if shouldRefresh && !idle {
+			entry.refreshing = true
+		}
+		entry.mu.Unlock()
+
+		if idle {
+			delete(r.entries, key)
+		} else if shouldRefresh {
+			due = append(due, entry)
+		}
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(due))
+	for _, entry := range due {
+		go func(entry *refreshEntry) {
+			defer wg.Done()
+			r.refresh(entry)
+
+			entry.mu.Lock()
+			entry.refreshing = false
+			entry.mu.Unlock()
+		}(entry)
+	}
+	return &wg
+}
+
+// refresh loads and stores the value of the entry, sharing the load with any
+// concurrent refresh of the same key.
+func (r *refreshAhead) refresh(entry *refreshEntry) (interface{}, error) {
+	value, err, _ := r.flight.Do(entry.key, context.Background(), func(context.Context) (value interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = errors.Errorf("Panic refreshing cache key: %v", p)
+			}
+			r.recordRefresh(entry, err)
+		}()
+
+		value, err = entry.loader()
+		if err != nil {
+			return nil, err
+		}
+		if err = r.storage.Set(entry.key, value, entry.ttl); err != nil {
+			return nil, err
+		}
+		return value, nil
+	})
+	return value, err
+}
+
+func (r *refreshAhead) recordRefresh(entry *refreshEntry, err error) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if err == nil {
+		entry.failures = 0
+		entry.nextAttempt = time.Time{}
+		entry.freshUntil = time.Now().Add(entry.ttl)
+		return
+	}
+
+	entry.failures++
+	entry.nextAttempt = time.Now().Add(r.backoff(entry.failures))
+	logRefreshError(entry.key, entry.failures, err)
+}
+
+func (r *refreshAhead) refreshBefore(entry *refreshEntry) time.Duration {
+	if r.opts.RefreshBefore > 0 {
+		return r.opts.RefreshBefore
+	}
+	return entry.ttl / 10
+}
+
+func (r *refreshAhead) backoff(failures int) time.Duration {
+	backoff := r.opts.MinBackoff
+	for i := 1; i < failures && backoff < r.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return minDuration(backoff, r.opts.MaxBackoff)
+}
+
+func logRefreshError(key string, failures int, err error) {
+	logger(refreshAheadLogCategory, "refresh_error", key).
+		WithField("failures", failures).
+		WithError(err).
+		Error("Failed to refresh cache entry ahead of expiration")
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	store := NewFakeCache()
+	storage := WithStaleFallback(store, 20*time.Minute)
+
+	// A long check interval so that refreshes are only triggered by the tests.
+	opts := RefreshAheadOptions{CheckInterval: time.Hour, IdleExpiry: 10 * time.Minute, MinBackoff: 10 * time.Second}
+	ttl := 5 * time.Minute
+	expectedErr := errors.New("I am expected")
+
+	Convey("RefreshAhead", t, func() {
+		key := "refresh_ahead"
+
+		store.Reset()
+		subject := NewRefreshAhead(storage, opts).(*refreshAhead)
+		defer subject.Stop()
+
+		value := rand.Intn(100)
+		calls := 0
+		loader := func() (interface{}, error) {
+			calls++
+			return value, nil
+		}
+
+		Convey("It should load registered keys on a cold Get", func() {
+			So(subject.Register(key, ttl, loader), ShouldBeNil)
+
+			GetCacheHit(subject.Get, key, value)
+			So(calls, ShouldEqual, 1)
+			GetCacheHit(subject.Get, key, value)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("It should miss unregistered keys", func() {
+			GetCacheMiss(subject.Get, key)
+		})
+
+		Convey("It should refresh keys that are about to expire", func() {
+			So(subject.Register(key, ttl, loader), ShouldBeNil)
+			subject.refreshDue(time.Now()).Wait()
+			So(calls, ShouldEqual, 1)
+
+			subject.refreshDue(time.Now()).Wait()
+			So(calls, ShouldEqual, 1)
+
+			subject.refreshDue(time.Now().Add(ttl - ttl/20)).Wait()
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("It should keep the old value and back off on errors", func() {
+			storage.Set(key, value, 0)
+
+			failures := 0
+			So(subject.Register(key, ttl, func() (interface{}, error) {
+				failures++
+				return nil, expectedErr
+			}), ShouldBeNil)
+
+			subject.refreshDue(time.Now()).Wait()
+			So(failures, ShouldEqual, 1)
+			GetCacheHit(subject.Get, key, value)
+
+			subject.refreshDue(time.Now()).Wait()
+			So(failures, ShouldEqual, 1)
+
+			subject.refreshDue(time.Now().Add(opts.MinBackoff)).Wait()
+			So(failures, ShouldEqual, 2)
+		})
+
+		Convey("It should not wait for hung refreshes to refresh other keys", func() {
+			started, release := make(chan struct{}), make(chan struct{})
+			So(subject.Register("hung", ttl, func() (interface{}, error) {
+				close(started)
+				<-release
+				return value, nil
+			}), ShouldBeNil)
+			hung := subject.refreshDue(time.Now())
+			defer func() {
+				close(release)
+				hung.Wait()
+			}()
+			<-started
+
+			So(subject.Register(key, ttl, loader), ShouldBeNil)
+			subject.refreshDue(time.Now()).Wait()
+			So(calls, ShouldEqual, 1)
+
+			// The hung loader would panic if called again, closing started twice.
+			subject.refreshDue(time.Now().Add(ttl)).Wait()
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("It should share the load of a cold Get with a background refresh", func() {
+			release := make(chan struct{})
+			So(subject.Register(key, ttl, func() (interface{}, error) {
+				<-release
+				return loader()
+			}), ShouldBeNil)
+
+			refreshes := subject.refreshDue(time.Now())
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				close(release)
+			}()
+			GetCacheHit(subject.Get, key, value)
+			refreshes.Wait()
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("It should expire registrations that are not read", func() {
+			So(subject.Register(key, ttl, loader), ShouldBeNil)
+
+			subject.refreshDue(time.Now().Add(2 * opts.IdleExpiry)).Wait()
+			So(calls, ShouldEqual, 0)
+			So(subject.entry(key), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type requestScopeKey struct{}
+
+// requestScope holds a memo for each cache wrapped with RequestScoped during a
+// request, so that caches sharing keys don't see each other's values.
+type requestScope struct {
+	mu    sync.Mutex
+	memos map[Cache]*requestMemo
+}
+
+// requestMemo holds the values already resolved from a cache during a request,
+// indexed by key and by the type they were decoded into, together with the
+// entry information of those resolved with GetWithInfo.
+type requestMemo struct {
+	mu     sync.RWMutex
+	values map[string]map[reflect.Type]reflect.Value
+	infos  map[string]Info
+}
+
+// WithRequestScope attaches a memo to the context, through which caches wrapped
+// with RequestScoped remember the values resolved during a request. The memo is
+// discarded together with the context when the request ends.
+func WithRequestScope(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+		return ctx
+	}
+	scope := &requestScope{memos: map[Cache]*requestMemo{}}
+	return context.WithValue(ctx, requestScopeKey{}, scope)
+}
+
+// RequestScopeMiddleware installs a request scope (see WithRequestScope) in the
+// context of every request.
+func RequestScopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithRequestScope(c.Request.Context()))
+		c.Next()
+	}
+}
+
+// RequestScoped returns a cache that consults the memo of the request scope in
+// ctx before the given cache, so that resolving the same key many times within
+// a request only goes through the underlying cache (and its decoding) once. If
+// ctx has no request scope, the cache itself is returned. Each cache gets its
+// own memo, so c must be comparable (e.g. a pointer), otherwise it is returned
+// as is too. If c implements Informer, so does the returned cache.
+//
+// Values are shared by all callers within the request, so they must not be
+// mutated.
+func RequestScoped(ctx context.Context, c Cache) Cache {
+	scope, ok := ctx.Value(requestScopeKey{}).(*requestScope)
+	if !ok || !reflect.TypeOf(c).Comparable() {
+		return c
+	}
+
+	scoped := requestScopedCache{cache: c, memo: scope.memoFor(c)}
+	if informer, ok := c.(Informer); ok {
+		return &requestScopedInformer{scoped, informer}
+	}
+	return &scoped
+}
+
+func (s *requestScope) memoFor(c Cache) *requestMemo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	memo, ok := s.memos[c]
+	if !ok {
+		memo = &requestMemo{
+			values: map[string]map[reflect.Type]reflect.Value{},
+			infos:  map[string]Info{},
+		}
+		s.memos[c] = memo
+	}
+	return memo
+}
+
+type requestScopedCache struct {
+	cache Cache
+	memo  *requestMemo
+}
+
+func (c *requestScopedCache) Get(key string, result interface{}) (bool, error) {
+	if c.memo.load(key, result) {
+		return true, nil
+	}
+
+	cached, err := c.cache.Get(key, result)
+	if err == nil && cached {
+		c.memo.store(key, result)
+	}
+	return cached, err
+}
+
+func (c *requestScopedCache) Set(key string, value interface{}, duration time.Duration) error {
+	c.memo.invalidate(key)
+	return c.cache.Set(key, value, duration)
+}
+
+func (c *requestScopedCache) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	if c.memo.load(key, result) {
+		return nil
+	}
+
+	err := c.cache.GetOrSet(key, result, duration, fetch)
+	if err == nil {
+		c.memo.store(key, result)
+	}
+	return err
+}
+
+// requestScopedInformer is the requestScopedCache of a cache implementing
+// Informer, which keeps reporting the entry information of memoized values.
+type requestScopedInformer struct {
+	requestScopedCache
+	informer Informer
+}
+
+func (c *requestScopedInformer) GetWithInfo(key string, result interface{}) (Info, error) {
+	if info, ok := c.memo.loadWithInfo(key, result); ok {
+		return info, nil
+	}
+
+	info, err := c.informer.GetWithInfo(key, result)
+	if err == nil && info.Hit {
+		c.memo.storeWithInfo(key, result, info)
+	}
+	return info, err
+}
+
+func (m *requestMemo) load(key string, result interface{}) bool {
+	resultRv := reflect.ValueOf(result)
+	if resultRv.Kind() != reflect.Ptr || resultRv.IsNil() {
+		return false
+	}
+
+	m.mu.RLock()
+	value, ok := m.values[key][resultRv.Type().Elem()]
+	m.mu.RUnlock()
+	if ok {
+		resultRv.Elem().Set(value)
+	}
+	return ok
+}
+
+// loadWithInfo only loads values memoized with their entry information.
+func (m *requestMemo) loadWithInfo(key string, result interface{}) (Info, bool) {
+	m.mu.RLock()
+	info, ok := m.infos[key]
+	m.mu.RUnlock()
+	if !ok || !m.load(key, result) {
+		return Info{}, false
+	}
+	return info, true
+}
+
+func (m *requestMemo) store(key string, result interface{}) {
+	resultRv := reflect.ValueOf(result)
+	if resultRv.Kind() != reflect.Ptr || resultRv.IsNil() {
+		return
+	}
+
+	// Copy the value, otherwise later changes to the result variable itself
+	// would also change the memoized value.
+	value := reflect.New(resultRv.Type().Elem()).Elem()
+	value.Set(resultRv.Elem())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byType, ok := m.values[key]
+	if !ok {
+		byType = map[reflect.Type]reflect.Value{}
+		m.values[key] = byType
+	}
+	byType[value.Type()] = value
+}
+
+func (m *requestMemo) storeWithInfo(key string, result interface{}, info Info) {
+	m.store(key, result)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.infos[key] = info
+}
+
+func (m *requestMemo) invalidate(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	delete(m.infos, key)
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+)
+
+func TestRequestScopedCache(t *testing.T) {
+	store := NewFakeCache()
+	duration := 5 * time.Minute
+	expectedErr := errors.New("I am expected")
+
+	Convey("RequestScoped", t, func() {
+		key := "request_scoped"
+
+		store.Reset()
+
+		value := rand.Intn(100)
+		subject := RequestScoped(WithRequestScope(context.Background()), store)
+
+		Convey("It should return the cache itself without a request scope", func() {
+			So(RequestScoped(context.Background(), store), ShouldEqual, store)
+		})
+
+		Convey("It should only get from the cache once", func() {
+			store.Populate(key, value, duration)
+
+			GetCacheHit(subject.Get, key, value)
+			GetCacheHit(subject.Get, key, value)
+			So(store.GetMustHaveBeenCalledWith(key, 1), ShouldBeNil)
+		})
+
+		Convey("It should not remember misses", func() {
+			GetCacheMiss(subject.Get, key)
+			store.Populate(key, value, duration)
+
+			GetCacheHit(subject.Get, key, value)
+		})
+
+		Convey("It should not remember errors", func() {
+			store.FailGetFor(key, expectedErr)
+			GetCacheError(subject.Get, key)
+		})
+
+		Convey("It should remember values per result type", func() {
+			store.Populate(key, value, duration)
+
+			GetCacheHit(subject.Get, key, value)
+			var asFloat float64
+			cached, err := subject.Get(key, &asFloat)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(asFloat, ShouldEqual, float64(value))
+		})
+
+		Convey("It should forget values on Set", func() {
+			store.Populate(key, -1, duration)
+			GetCacheHit(subject.Get, key, -1)
+
+			So(subject.Set(key, value, duration), ShouldBeNil)
+			GetCacheHit(subject.Get, key, value)
+		})
+
+		Convey("It should remember values from GetOrSet", func() {
+			GetOrSetFetch(subject.GetOrSet, key, duration, value)
+			GetOrSetCached(subject.GetOrSet, key, duration, value)
+			So(store.GetOrSetMustHaveBeenCalledWith(key, 1, duration), ShouldBeNil)
+		})
+
+		Convey("It should not share memos between caches", func() {
+			otherStore := NewFakeCache()
+			scope := WithRequestScope(context.Background())
+			subject := RequestScoped(scope, store)
+			other := RequestScoped(scope, otherStore)
+
+			store.Populate(key, value, duration)
+			otherStore.Populate(key, value+1, duration)
+
+			GetCacheHit(subject.Get, key, value)
+			GetCacheHit(other.Get, key, value+1)
+			GetCacheHit(RequestScoped(scope, store).Get, key, value)
+			So(store.GetMustHaveBeenCalledWith(key, 1), ShouldBeNil)
+			So(otherStore.GetMustHaveBeenCalledWith(key, 1), ShouldBeNil)
+		})
+
+		Convey("It should not share memos between requests", func() {
+			store.Populate(key, value, duration)
+			GetCacheHit(subject.Get, key, value)
+
+			other := RequestScoped(WithRequestScope(context.Background()), store)
+			GetCacheHit(other.Get, key, value)
+			So(store.GetMustHaveBeenCalledWith(key, 2), ShouldBeNil)
+		})
+	})
+
+	Convey("RequestScoped informers", t, func() {
+		key := "request_scoped_info"
+		local := NewFakeCache()
+		remote := NewFakeCache()
+		hybrid := Hybrid(local, remote)
+		value := rand.Intn(100)
+		So(hybrid.Set(key, value, duration), ShouldBeNil)
+		local.DeleteKey(key)
+
+		subject := RequestScoped(WithRequestScope(context.Background()), hybrid)
+
+		Convey("It should pass through the entry information", func() {
+			_, ok := RequestScoped(WithRequestScope(context.Background()), store).(Informer)
+			So(ok, ShouldBeFalse)
+
+			var data int
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Hit, ShouldBeTrue)
+			So(info.Tier, ShouldEqual, TierRemote)
+		})
+
+		Convey("It should remember the entry information with the value", func() {
+			var data int
+			_, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Tier, ShouldEqual, TierRemote)
+			So(remote.GetMustHaveBeenCalledWith(key, 1), ShouldBeNil)
+		})
+
+		Convey("It should get the entry information of values remembered without it", func() {
+			GetCacheHit(subject.Get, key, value)
+
+			var data int
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(info.Hit, ShouldBeTrue)
+			So(info.Tier, ShouldEqual, TierLocal)
+		})
+
+		Convey("It should forget the entry information on Set", func() {
+			var data int
+			_, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(subject.Set(key, value+1, duration), ShouldBeNil)
+
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value+1)
+			So(info.Tier, ShouldEqual, TierLocal)
+		})
+	})
+
+	Convey("RequestScopeMiddleware", t, func() {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(RequestScopeMiddleware())
+
+		scoped := false
+		router.GET("/", func(c *gin.Context) {
+			_, scoped = RequestScoped(c.Request.Context(), store).(*requestScopedCache)
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		So(scoped, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/reflext"
+)
+
+const (
+	defaultShards     = 64
+	defaultMaxSizeMiB = 128
+	slabsPerShard     = 8
+	minSlabSize       = 64 * 1024
+
+	// Each entry is saved in a slab as: expiration (unix nanos) | key length |
+	// value length | key | value.
+	entryHeaderSize = 8 + 2 + 4
+	maxKeyLength    = 1<<16 - 1
+)
+
+type ShardedOptions struct {
+	// Shards is the number of independently locked shards, rounded up to a power
+	// of two. Defaults to 64.
+	Shards int
+	// MaxSizeMiB is the total memory used for storing entries. Defaults to 128.
+	// Each shard holds MaxSizeMiB/Shards, split in 8 slabs which are evicted
+	// whole when the shard is full, oldest first. A single entry can't be larger
+	// than a slab.
+	MaxSizeMiB int
+}
+
+// NewSharded creates an in-process cache for low GC overhead when holding many
+// entries. Instead of a map of interface{} values, which the GC must scan, the
+// entries are serialized and packed into large byte slabs indexed by maps of
+// integers, neither of which contain pointers. See the benchmarks in
+// shardedCache_test.go for comparisons with NewMemory.
+//
+// Values of type []byte and json.RawMessage are stored as is, while all others
+// are stored in their JSON form, so it is well suited as the local tier of a
+// Hybrid cache. Returned values are always independent copies.
+func NewSharded(opts ShardedOptions) Cache {
+	if opts.Shards <= 0 {
+		opts.Shards = defaultShards
+	}
+	if opts.MaxSizeMiB <= 0 {
+		opts.MaxSizeMiB = defaultMaxSizeMiB
+	}
+
+	numShards := 1
+	for numShards < opts.Shards {
+		numShards *= 2
+	}
+	slabSize := opts.MaxSizeMiB * 1024 * 1024 / numShards / slabsPerShard
+	if slabSize < minSlabSize {
+		slabSize = minSlabSize
+	}
+
+	c := &shardedCache{
+		shards: make([]*cacheShard, numShards),
+		mask:   uint64(numShards - 1),
+	}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{
+			index:    map[uint64]uint64{},
+			slabs:    make([][]byte, slabsPerShard),
+			slabSize: slabSize,
+		}
+	}
+	return c
+}
+
+type shardedCache struct {
+	shards []*cacheShard
+	mask   uint64
+}
+
+func (c *shardedCache) Get(key string, result interface{}) (bool, error) {
+	hash := hashKey(key)
+	value, cached := c.shard(hash).get(key, hash, time.Now())
+	if !cached {
+		return false, nil
+	}
+
+	switch res := result.(type) {
+	case *[]byte:
+		*res = value
+	case *json.RawMessage:
+		*res = value
+	default:
+		if err := json.Unmarshal(value, result); err != nil {
+			return false, errors.Wrapf(err, "Failed to unmarshal cached data")
+		}
+	}
+	return true, nil
+}
+
+func (c *shardedCache) Set(key string, value interface{}, duration time.Duration) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case json.RawMessage:
+		bytes = v
+	default:
+		var err error
+		if bytes, err = json.Marshal(value); err != nil {
+			return errors.Wrapf(err, "Failed to serialize value for sharded cache")
+		}
+	}
+
+	hash := hashKey(key)
+	return c.shard(hash).set(key, hash, bytes, time.Now().Add(duration))
+}
+
+func (c *shardedCache) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	if err := ensureValidCacheKey(key); err != nil {
+		return err
+	}
+
+	if cached, _ := c.Get(key, result); cached {
+		return nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	c.Set(key, value, duration)
+	return reflext.SetPointer(result, value)
+}
+
+func (c *shardedCache) shard(hash uint64) *cacheShard {
+	return c.shards[hash&c.mask]
+}
+
+// cacheShard stores entries in a ring of slabs. Entries are appended to the
+// newest slab and, when it is full, the oldest slab is dropped together with
+// all of its entries to make room for a new one.
+//
+// Entry positions in the index are encoded as slab ID (high 32 bits) and offset
+// in the slab (low 32 bits). Slab IDs always increase, and the slab with a given
+// ID is at slabs[id%slabsPerShard] for as long as it's not dropped.
+type cacheShard struct {
+	mu       sync.RWMutex
+	index    map[uint64]uint64
+	slabs    [][]byte
+	slabSize int
+
+	// oldestSlab and newestSlab are IDs, while newestSlab is only valid if the
+	// shard has any slab allocated (i.e. slabs[0] != nil).
+	oldestSlab uint32
+	newestSlab uint32
+}
+
+func (s *cacheShard) get(key string, hash uint64, now time.Time) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pos, ok := s.index[hash]
+	if !ok {
+		return nil, false
+	}
+
+	entry := s.entryAt(pos)
+	expiration := int64(binary.LittleEndian.Uint64(entry))
+	keyLen := int(binary.LittleEndian.Uint16(entry[8:]))
+	valueLen := int(binary.LittleEndian.Uint32(entry[10:]))
+	entryKey := entry[entryHeaderSize : entryHeaderSize+keyLen]
+	if string(entryKey) != key || now.UnixNano() >= expiration {
+		// A hash collision or an expired entry, which will be dropped together
+		// with its slab.
+		return nil, false
+	}
+
+	value := make([]byte, valueLen)
+	copy(value, entry[entryHeaderSize+keyLen:])
+	return value, true
+}
+
+func (s *cacheShard) set(key string, hash uint64, value []byte, expiration time.Time) error {
+	if len(key) > maxKeyLength {
+		return errors.Errorf("Key too long for sharded cache: %d bytes", len(key))
+	}
+	entrySize := entryHeaderSize + len(key) + len(value)
+	if entrySize > s.slabSize {
+		return errors.Errorf("Entry too large for sharded cache: %d bytes (max %d)", entrySize, s.slabSize)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slab := s.slabs[s.newestSlab%slabsPerShard]
+	if slab == nil || len(slab)+entrySize > s.slabSize {
+		slab = s.rotate()
+	}
+
+	offset := len(slab)
+	slab = slab[:offset+entrySize]
+	binary.LittleEndian.PutUint64(slab[offset:], uint64(expiration.UnixNano()))
+	binary.LittleEndian.PutUint16(slab[offset+8:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(slab[offset+10:], uint32(len(value)))
+	copy(slab[offset+entryHeaderSize:], key)
+	copy(slab[offset+entryHeaderSize+len(key):], value)
+
+	s.slabs[s.newestSlab%slabsPerShard] = slab
+	s.index[hash] = uint64(s.newestSlab)<<32 | uint64(offset)
+	return nil
+}
+
+// rotate makes room for a new slab, dropping the oldest one if all are in use,
+// and returns the new (empty) slab.
+func (s *cacheShard) rotate() []byte {
+	if s.slabs[s.newestSlab%slabsPerShard] == nil {
+		// First slab of this shard.
+		s.slabs[0] = make([]byte, 0, s.slabSize)
+		return s.slabs[0]
+	}
+
+	s.newestSlab++
+	idx := s.newestSlab % slabsPerShard
+	slab := s.slabs[idx]
+	if slab == nil {
+		slab = make([]byte, 0, s.slabSize)
+	} else {
+		s.dropEntries(s.oldestSlab, slab)
+		s.oldestSlab++
+		slab = slab[:0]
+	}
+	s.slabs[idx] = slab
+	return slab
+}
+
+func (s *cacheShard) dropEntries(slabID uint32, slab []byte) {
+	for offset := 0; offset < len(slab); {
+		keyLen := int(binary.LittleEndian.Uint16(slab[offset+8:]))
+		valueLen := int(binary.LittleEndian.Uint32(slab[offset+10:]))
+		key := slab[offset+entryHeaderSize : offset+entryHeaderSize+keyLen]
+
+		hash := hashKeyBytes(key)
+		if s.index[hash] == uint64(slabID)<<32|uint64(offset) {
+			delete(s.index, hash)
+		}
+		offset += entryHeaderSize + keyLen + valueLen
+	}
+}
+
+func (s *cacheShard) entryAt(pos uint64) []byte {
+	slab := s.slabs[uint32(pos>>32)%slabsPerShard]
+	return slab[uint32(pos):]
+}
+
+// FNV-1a, inlined to avoid allocating a hash.Hash on every operation.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+func hashKey(key string) uint64 {
+	hash := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= fnvPrime64
+	}
+	return hash
+}
+
+func hashKeyBytes(key []byte) uint64 {
+	hash := uint64(fnvOffset64)
+	for _, b := range key {
+		hash ^= uint64(b)
+		hash *= fnvPrime64
+	}
+	return hash
+}
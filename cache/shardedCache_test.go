@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+)
+
+func TestShardedCache(t *testing.T) {
+	duration := 5 * time.Minute
+
+	Convey("Sharded cache", t, func() {
+		key := "sharded_cache"
+		value := rand.Intn(100)
+		subject := NewSharded(ShardedOptions{Shards: 4, MaxSizeMiB: 1})
+
+		Convey("It should return cached data", func() {
+			So(subject.Set(key, value, duration), ShouldBeNil)
+			GetCacheHit(subject.Get, key, value)
+		})
+
+		Convey("It should miss if data is not present", func() {
+			GetCacheMiss(subject.Get, key)
+		})
+
+		Convey("It should miss expired data", func() {
+			So(subject.Set(key, value, 0), ShouldBeNil)
+			GetCacheMiss(subject.Get, key)
+		})
+
+		Convey("It should overwrite data", func() {
+			So(subject.Set(key, -1, duration), ShouldBeNil)
+			So(subject.Set(key, value, duration), ShouldBeNil)
+			GetCacheHit(subject.Get, key, value)
+		})
+
+		Convey("It should store raw JSON as is", func() {
+			raw := json.RawMessage(`{"a":1}`)
+			So(subject.Set(key, raw, duration), ShouldBeNil)
+
+			var result json.RawMessage
+			cached, err := subject.Get(key, &result)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(string(result), ShouldEqual, string(raw))
+
+			result[0] = '['
+			subject.Get(key, &result)
+			So(string(result), ShouldEqual, string(raw))
+		})
+
+		Convey("It should reject entries larger than a slab", func() {
+			So(subject.Set(key, make([]byte, 1024*1024), duration), ShouldNotBeNil)
+		})
+
+		Convey("It should evict the oldest entries when full", func() {
+			payload := make([]byte, 1024)
+			for i := 0; i < 2000; i++ {
+				So(subject.Set(fmt.Sprint("key", i), payload, duration), ShouldBeNil)
+			}
+
+			var result []byte
+			cached, err := subject.Get("key0", &result)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeFalse)
+
+			cached, err = subject.Get("key1999", &result)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(len(result), ShouldEqual, len(payload))
+		})
+
+		Convey("It should work as the local tier of a hybrid cache", func() {
+			hybrid := Hybrid(subject, NewFakeCache())
+			So(hybrid.Set(key, value, duration), ShouldBeNil)
+			GetCacheHit(hybrid.Get, key, value)
+		})
+
+		Convey("GetOrSet", func() {
+			GetOrSetFetch(subject.GetOrSet, key, duration, value)
+			GetOrSetCached(subject.GetOrSet, key, duration, value)
+		})
+	})
+}
+
+func BenchmarkLocalCacheGet(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		newCache func() Cache
+	}{
+		{"Memory", NewMemory},
+		{"Sharded", func() Cache { return NewSharded(ShardedOptions{}) }},
+	}
+
+	value := json.RawMessage(`{"name":"value","tags":["a","b","c"]}`)
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			c := bm.newCache()
+			for i := 0; i < 1000; i++ {
+				c.Set(fmt.Sprint("key", i), value, time.Hour)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var result json.RawMessage
+				for i := 0; pb.Next(); i++ {
+					c.Get(fmt.Sprint("key", i%1000), &result)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLocalCacheSet(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		newCache func() Cache
+	}{
+		{"Memory", NewMemory},
+		{"Sharded", func() Cache { return NewSharded(ShardedOptions{}) }},
+	}
+
+	value := json.RawMessage(`{"name":"value","tags":["a","b","c"]}`)
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			c := bm.newCache()
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					c.Set(fmt.Sprint("key", i%100000), value, time.Hour)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLocalCacheGC measures the duration of a GC cycle while each cache
+// holds many entries, which is what the sharded cache is optimized for.
+func BenchmarkLocalCacheGC(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		newCache func() Cache
+	}{
+		{"Memory", NewMemory},
+		{"Sharded", func() Cache { return NewSharded(ShardedOptions{MaxSizeMiB: 512}) }},
+	}
+
+	value := json.RawMessage(`{"name":"value","tags":["a","b","c"]}`)
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			c := bm.newCache()
+			for i := 0; i < 1000000; i++ {
+				c.Set(fmt.Sprint("key", i), value, time.Hour)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			runtime.KeepAlive(c)
+		})
+	}
+}
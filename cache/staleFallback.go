@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/vtex/go-io/reflext"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -13,15 +14,41 @@ const (
 )
 
 func WithStaleFallback(storage Cache, staleTTL time.Duration) Stale {
+	return WithStaleFallbackOptions(storage, StaleOptions{StaleTTL: staleTTL})
+}
+
+type StaleOptions struct {
+	// StaleTTL is for how long values are kept in the storage, including the
+	// time they are stale.
+	StaleTTL time.Duration
+	// SoftTimeout, if set, is how long GetOrSet waits for fetch to return when a
+	// stale value is available. After that the stale value is returned and the
+	// fetch keeps going in the background to refresh the cache.
+	SoftTimeout time.Duration
+	// ShouldFallback decides which fetch errors allow falling back to stale data.
+	// By default all errors do.
+	ShouldFallback func(err error) bool
+}
+
+func WithStaleFallbackOptions(storage Cache, opts StaleOptions) Stale {
 	return &staleFallbackCache{
-		cache:    storage,
-		staleTTL: staleTTL,
+		cache:          storage,
+		staleTTL:       opts.StaleTTL,
+		softTimeout:    opts.SoftTimeout,
+		shouldFallback: opts.ShouldFallback,
 	}
 }
 
 type staleFallbackCache struct {
-	cache    Cache
-	staleTTL time.Duration
+	cache          Cache
+	staleTTL       time.Duration
+	softTimeout    time.Duration
+	shouldFallback func(err error) bool
+
+	// flight coalesces the fetches of GetOrSet with a soft timeout, which may
+	// outlive their callers, so that a slow upstream is not fetched again by
+	// every caller that times out.
+	flight singleflight.Group
 }
 
 func (c *staleFallbackCache) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
@@ -39,20 +66,67 @@ func (c *staleFallbackCache) GetOrSet(key string, result interface{}, duration t
 		return nil
 	}
 
+	if cached && c.softTimeout > 0 {
+		return c.fetchWithSoftTimeout(key, result, duration, fetch)
+	}
+
 	value, fetchErr := fetch()
 	if fetchErr != nil {
-		if cached {
-			// We have an error, but we want to behave as if we do not. Just log it.
-			logStaleCacheUsed(key, fetchErr)
-			return nil
+		if !cached {
+			return errors.Wrapf(fetchErr, "Failed to fetch data and no stale version found")
+		} else if !c.canFallback(fetchErr) {
+			return errors.Wrapf(fetchErr, "Failed to fetch data and error is not eligible for stale fallback")
 		}
-		return errors.Wrapf(fetchErr, "Failed to fetch data and no stale version found")
+		// We have an error, but we want to behave as if we do not. Just log it.
+		logStaleCacheUsed(key, fetchErr)
+		return nil
 	}
 
 	c.Set(key, value, duration)
 	return reflext.SetPointer(result, value)
 }
 
+// fetchWithSoftTimeout must only be called when result already holds a stale
+// value, which is kept if fetch takes longer than the soft timeout.
+func (c *staleFallbackCache) fetchWithSoftTimeout(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	// The channel is buffered, so the fetching routine never blocks after a timeout.
+	done := c.flight.DoChan(key, func() (value interface{}, err error) {
+		defer func() {
+			// Panics must not escape, since the fetch runs in its own goroutine.
+			if r := recover(); r != nil {
+				err = errors.Errorf("Panic fetching data: %v", r)
+			}
+			if err == nil {
+				c.Set(key, value, duration)
+			}
+		}()
+		return fetch()
+	})
+
+	timer := time.NewTimer(c.softTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		if res.Err != nil {
+			if c.canFallback(res.Err) {
+				logStaleCacheUsed(key, res.Err)
+				return nil
+			}
+			return errors.Wrapf(res.Err, "Failed to fetch data and error is not eligible for stale fallback")
+		}
+		return reflext.SetPointer(result, res.Val)
+
+	case <-timer.C:
+		logStaleCacheUsed(key, errors.Errorf("Fetch did not return within soft timeout of %s", c.softTimeout))
+		return nil
+	}
+}
+
+func (c *staleFallbackCache) canFallback(err error) bool {
+	return c.shouldFallback == nil || c.shouldFallback(err)
+}
+
 // Get tries to get a fresh cached version of the data.
 func (c *staleFallbackCache) Get(key string, result interface{}) (bool, error) {
 	_, fresh, err := c.get(key, result)
@@ -77,14 +151,29 @@ func (c *staleFallbackCache) Set(key string, value interface{}, duration time.Du
 	return c.cache.Set(key, cachedData, c.staleTTL)
 }
 
+// GetWithInfo works like GetStale, also reporting whether the entry is stale
+// and, if the storage is a multi-layer cache, which tier it came from.
+func (c *staleFallbackCache) GetWithInfo(key string, result interface{}) (Info, error) {
+	info, _, err := c.getWithInfo(key, result)
+	return info, err
+}
+
 func (c *staleFallbackCache) get(key string, result interface{}) (cached bool, fresh bool, err error) {
+	info, cached, err := c.getWithInfo(key, result)
+	return cached, cached && !info.Stale, err
+}
+
+func (c *staleFallbackCache) getWithInfo(key string, result interface{}) (info Info, cached bool, err error) {
 	var cachedData cachedValue
-	cached, err = c.cache.Get(key, &cachedData)
-	if err != nil || !cached {
-		return false, false, err
+	storageInfo, err := GetWithInfo(c.cache, key, &cachedData)
+	if err != nil || !storageInfo.Hit {
+		return Info{}, false, err
 	}
 
-	return true, cachedData.TTL() > 0, json.Unmarshal(cachedData.Value, result)
+	if err := json.Unmarshal(cachedData.Value, result); err != nil {
+		return Info{}, true, err
+	}
+	return cachedData.info(storageInfo.Tier), true, nil
 }
 
 func logStaleCacheUsed(key string, err error) {
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"math/rand"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -78,6 +79,54 @@ func TestStaleFallbackCache(t *testing.T) {
 		})
 	})
 
+	Convey("GetWithInfo", t, func() {
+		key := "stale_fallback_get_with_info"
+
+		store.Reset()
+
+		value := rand.Intn(100)
+		data := -1
+
+		Convey("It should report fresh entries", func() {
+			subject.Set(key, value, duration)
+
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Hit, ShouldBeTrue)
+			So(info.Stale, ShouldBeFalse)
+			So(info.Age, ShouldBeLessThan, time.Second)
+		})
+
+		Convey("It should report stale entries", func() {
+			subject.Set(key, value, 0)
+
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Hit, ShouldBeTrue)
+			So(info.Stale, ShouldBeTrue)
+		})
+
+		Convey("It should report the tier of a hybrid storage", func() {
+			remote := NewFakeCache()
+			hybrid := WithStaleFallback(Hybrid(store, remote), staleTTL)
+			hybrid.Set(key, value, duration)
+			store.DeleteKey(key)
+
+			info, err := GetWithInfo(hybrid, key, &data)
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(info.Tier, ShouldEqual, TierRemote)
+		})
+
+		Convey("It should report a miss if data is not present", func() {
+			info, err := GetWithInfo(subject, key, &data)
+			So(err, ShouldBeNil)
+			So(info.Hit, ShouldBeFalse)
+		})
+	})
+
 	Convey("Set", t, func() {
 		key := "stale_fallback_set"
 
@@ -164,5 +213,87 @@ func TestStaleFallbackCache(t *testing.T) {
 
 			GetOrSetError(subject.GetOrSet, key, duration, fetchErr)
 		})
+
+		Convey("It should return the fetch error if it is not eligible for fallback", func() {
+			strict := WithStaleFallbackOptions(store, StaleOptions{
+				StaleTTL:       staleTTL,
+				ShouldFallback: func(err error) bool { return err != expectedErr },
+			})
+			strict.Set(key, value, 0)
+
+			So(errors.Cause(strict.GetOrSet(key, &data, duration, Fetch(nil, expectedErr))), ShouldEqual, expectedErr)
+			So(strict.GetOrSet(key, &data, duration, Fetch(nil, errors.New("Eligible"))), ShouldBeNil)
+			So(data, ShouldEqual, value)
+		})
+	})
+
+	Convey("GetOrSet with soft timeout", t, func() {
+		key := "stale_fallback_soft_timeout"
+
+		// The fetch keeps running in background, so use a thread-safe storage.
+		softTimeout := 10 * time.Millisecond
+		subject := WithStaleFallbackOptions(NewMemory(), StaleOptions{StaleTTL: staleTTL, SoftTimeout: softTimeout})
+
+		value := rand.Intn(100)
+		data := -1
+
+		Convey("It should return fetched data if fetch returns in time", func() {
+			subject.Set(key, -1, 0)
+
+			GetOrSetFetch(subject.GetOrSet, key, duration, value)
+		})
+
+		Convey("It should return stale data if fetch times out and refresh in background", func() {
+			subject.Set(key, value, 0)
+
+			release := make(chan struct{})
+			err := subject.GetOrSet(key, &data, duration, func() (interface{}, error) {
+				<-release
+				return value + 1, nil
+			})
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+
+			close(release)
+			deadline := time.Now().Add(time.Second)
+			for fresh, _ := subject.Get(key, &data); !fresh && time.Now().Before(deadline); fresh, _ = subject.Get(key, &data) {
+				time.Sleep(time.Millisecond)
+			}
+			So(data, ShouldEqual, value+1)
+		})
+
+		Convey("It should share the background fetch between callers that time out", func() {
+			subject.Set(key, value, 0)
+
+			release := make(chan struct{})
+			defer close(release)
+			var fetches int32
+			fetch := func() (interface{}, error) {
+				atomic.AddInt32(&fetches, 1)
+				<-release
+				return value + 1, nil
+			}
+
+			So(subject.GetOrSet(key, &data, duration, fetch), ShouldBeNil)
+			So(subject.GetOrSet(key, &data, duration, fetch), ShouldBeNil)
+			So(data, ShouldEqual, value)
+			So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+		})
+
+		Convey("It should return stale data if fetch fails before the timeout", func() {
+			subject.Set(key, value, 0)
+
+			So(subject.GetOrSet(key, &data, duration, Fetch(nil, expectedErr)), ShouldBeNil)
+			So(data, ShouldEqual, value)
+		})
+
+		Convey("It should wait for fetch if there is no stale data", func() {
+			err := subject.GetOrSet(key+"_missing", &data, duration, func() (interface{}, error) {
+				time.Sleep(2 * softTimeout)
+				return value, nil
+			})
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, value)
+		})
 	})
 }
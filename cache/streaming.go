@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"io"
+	"time"
+
+	"github.com/vtex/go-io/ioext"
+)
+
+const (
+	streamingCacheLogCategory = "streaming_cache"
+)
+
+// Streaming is implemented by caches which are able to store and serve values
+// as streams, without materializing them entirely in memory. It is meant for
+// large values like proxied assets.
+type Streaming interface {
+	// GetReader returns a reader for the cached value, or false if it's not
+	// cached. The reader must always be closed by the caller.
+	GetReader(key string) (io.ReadCloser, bool, error)
+	// SetFromReader stores the contents read from r until EOF. The value is only
+	// committed to the cache if the reader reached EOF without errors.
+	SetFromReader(key string, r io.Reader, duration time.Duration) error
+}
+
+// StreamThrough returns a reader that streams body while concurrently storing
+// it in the cache, e.g. for caching a response in background while it's sent
+// to the client. The value is only stored if the returned reader is read until
+// EOF, so closing it earlier (like on a client disconnection) discards it.
+func StreamThrough(c Streaming, key string, body io.Reader, duration time.Duration) io.ReadCloser {
+	main, secondary := ioext.Tee(body)
+	go func() {
+		// Closing the secondary reader on errors unblocks the main one, which
+		// would otherwise wait for someone to read the data written to the pipe.
+		defer secondary.Close()
+		if err := c.SetFromReader(key, secondary, duration); err != nil {
+			logger(streamingCacheLogCategory, "set_from_reader_error", key).
+				WithError(err).
+				Error("Failed to store streamed value in cache")
+		}
+	}()
+	return main
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeStreaming struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	done chan struct{}
+}
+
+func (f *fakeStreaming) GetReader(key string) (io.ReadCloser, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return io.NopCloser(bytes.NewReader(value)), true, nil
+}
+
+func (f *fakeStreaming) SetFromReader(key string, r io.Reader, duration time.Duration) error {
+	defer close(f.done)
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = buf.Bytes()
+	return nil
+}
+
+func TestStreamThrough(t *testing.T) {
+	Convey("StreamThrough", t, func() {
+		key := "stream_through"
+		content := bytes.Repeat([]byte("large body "), 10000)
+		store := &fakeStreaming{data: map[string][]byte{}, done: make(chan struct{})}
+
+		Convey("It should store the body once fully read", func() {
+			reader := StreamThrough(store, key, bytes.NewReader(content), time.Minute)
+			read, err := io.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(reader.Close(), ShouldBeNil)
+			So(read, ShouldResemble, content)
+
+			<-store.done
+			cached, ok, err := store.GetReader(key)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			stored, _ := io.ReadAll(cached)
+			So(stored, ShouldResemble, content)
+		})
+
+		Convey("It should not store the body if closed before EOF", func() {
+			reader := StreamThrough(store, key, bytes.NewReader(content), time.Minute)
+			_, err := reader.Read(make([]byte, 100))
+			So(err, ShouldBeNil)
+			So(reader.Close(), ShouldBeNil)
+
+			<-store.done
+			_, ok, err := store.GetReader(key)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
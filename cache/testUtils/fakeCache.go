@@ -209,6 +209,13 @@ func (c *FakeCache) FailGetOrSetFor(key string, err error) {
 }
 
 func (c *FakeCache) logCall(method, key string, args ...interface{}) {
+	// Copy the arguments, so that values mutated by the caller after the call
+	// are still matched against what they were at the time of the call.
+	var copied []interface{}
+	if err := reflext.DeepCopy(&copied, args); err == nil {
+		args = copied
+	}
+
 	call := c.findCallMatching(method, key, args...)
 	if call != nil {
 		call.count++
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/reflext"
+)
+
+// Typed returns a cache that encodes values with the given type registry (see
+// reflext.TypeRegistry.Marshal) before handing them to the underlying cache, so
+// that interface-typed values like []Shape, or results of type *interface{},
+// are decoded back to their original Go types.
+func Typed(c Cache, types *reflext.TypeRegistry) Cache {
+	return &typedCache{cache: c, types: types}
+}
+
+// TypedStale is like Typed, but for stale caches.
+func TypedStale(c Stale, types *reflext.TypeRegistry) Stale {
+	return &typedStaleCache{typedCache{cache: c, types: types}, c}
+}
+
+type typedCache struct {
+	cache Cache
+	types *reflext.TypeRegistry
+}
+
+func (c *typedCache) Get(key string, result interface{}) (bool, error) {
+	return c.decode(c.cache.Get, key, result)
+}
+
+func (c *typedCache) Set(key string, value interface{}, duration time.Duration) error {
+	data, err := c.types.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode typed value")
+	}
+	return c.cache.Set(key, json.RawMessage(data), duration)
+}
+
+// GetOrSet delegates to the GetOrSet of the underlying cache, so that its
+// behavior (e.g. stale fallback) is kept, encoding the fetched value on the way.
+func (c *typedCache) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	var data json.RawMessage
+	err := c.cache.GetOrSet(key, &data, duration, func() (interface{}, error) {
+		value, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := c.types.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to encode typed value")
+		}
+		return json.RawMessage(encoded), nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.types.Unmarshal(data, result)
+}
+
+func (c *typedCache) decode(get func(string, interface{}) (bool, error), key string, result interface{}) (bool, error) {
+	var data json.RawMessage
+	cached, err := get(key, &data)
+	if err != nil || !cached {
+		return false, err
+	}
+
+	if err := c.types.Unmarshal(data, result); err != nil {
+		return false, errors.Wrapf(err, "Failed to decode typed value")
+	}
+	return true, nil
+}
+
+type typedStaleCache struct {
+	typedCache
+	stale Stale
+}
+
+func (c *typedStaleCache) GetStale(key string, result interface{}) (bool, error) {
+	return c.decode(c.stale.GetStale, key, result)
+}
+
+func (c *typedStaleCache) GetWithInfo(key string, result interface{}) (Info, error) {
+	var data json.RawMessage
+	info, err := GetWithInfo(c.stale, key, &data)
+	if err != nil || !info.Hit {
+		return info, err
+	}
+
+	if err := c.types.Unmarshal(data, result); err != nil {
+		return Info{}, errors.Wrapf(err, "Failed to decode typed value")
+	}
+	return info, nil
+}
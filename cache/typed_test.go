@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/vtex/go-io/cache/testUtils"
+	"github.com/vtex/go-io/reflext"
+)
+
+type typedTestShape interface {
+	Sides() int
+}
+
+type typedTestSquare struct{ Side int }
+
+func (typedTestSquare) Sides() int { return 4 }
+
+type typedTestTriangle struct{ Base, Height int }
+
+func (typedTestTriangle) Sides() int { return 3 }
+
+func TestTypedCache(t *testing.T) {
+	store := NewFakeCache()
+	duration := 5 * time.Minute
+	expectedErr := errors.New("I am expected")
+
+	types := reflext.NewTypeRegistry()
+	types.Register("square", typedTestSquare{})
+	types.Register("triangle", typedTestTriangle{})
+
+	shapes := []typedTestShape{typedTestSquare{2}, typedTestTriangle{3, 4}}
+
+	Convey("Typed", t, func() {
+		key := "typed_cache"
+
+		store.Reset()
+		subject := Typed(store, types)
+
+		Convey("It should decode interface values to their original types", func() {
+			So(subject.Set(key, shapes, duration), ShouldBeNil)
+
+			var result []typedTestShape
+			cached, err := subject.Get(key, &result)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(result, ShouldResemble, shapes)
+		})
+
+		Convey("It should decode registered types into interface{}", func() {
+			So(subject.Set(key, typedTestSquare{5}, duration), ShouldBeNil)
+
+			var result interface{}
+			cached, err := subject.Get(key, &result)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(result, ShouldResemble, typedTestSquare{5})
+		})
+
+		Convey("It should fail to set unregistered types in interfaces", func() {
+			So(subject.Set(key, []interface{}{struct{}{}}, duration), ShouldNotBeNil)
+		})
+
+		Convey("It should fetch and decode on GetOrSet", func() {
+			var result []typedTestShape
+			So(subject.GetOrSet(key, &result, duration, Fetch(shapes, nil)), ShouldBeNil)
+			So(result, ShouldResemble, shapes)
+
+			result = nil
+			So(subject.GetOrSet(key, &result, duration, FetchPanic), ShouldBeNil)
+			So(result, ShouldResemble, shapes)
+		})
+	})
+
+	Convey("TypedStale", t, func() {
+		key := "typed_stale_cache"
+
+		store.Reset()
+		subject := TypedStale(WithStaleFallback(store, 20*time.Minute), types)
+
+		Convey("It should decode stale interface values", func() {
+			So(subject.Set(key, shapes, 0), ShouldBeNil)
+
+			var result []typedTestShape
+			cached, err := subject.GetStale(key, &result)
+			So(err, ShouldBeNil)
+			So(cached, ShouldBeTrue)
+			So(result, ShouldResemble, shapes)
+
+			info, err := GetWithInfo(subject, key, &result)
+			So(err, ShouldBeNil)
+			So(info.Stale, ShouldBeTrue)
+		})
+
+		Convey("It should keep the stale fallback on GetOrSet", func() {
+			So(subject.Set(key, shapes, 0), ShouldBeNil)
+
+			var result []typedTestShape
+			So(subject.GetOrSet(key, &result, duration, Fetch(nil, expectedErr)), ShouldBeNil)
+			So(result, ShouldResemble, shapes)
+		})
+	})
+}
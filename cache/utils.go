@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -21,3 +23,17 @@ func logger(category, code, key string) *logrus.Entry {
 		"code":     code,
 	})
 }
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,57 @@
+// Package ratelimit provides rate limiters for throttling requests, either
+// locally to each instance or shared by all instances through Redis, and a gin
+// middleware using them.
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit allows Rate requests per Period, in bursts of up to Burst requests.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	// Burst defaults to Rate, allowing all requests of a period at once.
+	Burst int
+}
+
+// PerSecond, PerMinute and PerHour create limits with bursts equal to the rate.
+func PerSecond(rate int) Limit { return Limit{Rate: rate, Period: time.Second} }
+func PerMinute(rate int) Limit { return Limit{Rate: rate, Period: time.Minute} }
+func PerHour(rate int) Limit   { return Limit{Rate: rate, Period: time.Hour} }
+
+func (l Limit) withDefaults() (Limit, error) {
+	if l.Rate <= 0 || l.Period <= 0 {
+		return l, errors.Errorf("Invalid rate limit of %d per %s", l.Rate, l.Period)
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Rate
+	}
+	return l, nil
+}
+
+// interval is the time for a single request to be allowed again.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+// Result describes the decision of a limiter for a request.
+type Result struct {
+	Allowed bool
+	// Limit is the maximum number of requests allowed at once (i.e. the burst).
+	Limit int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// RetryAfter is how long until a request is allowed, when not Allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the limit is fully available again.
+	ResetAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow reports whether a request identified by key is allowed, counting it
+	// against the limit if so.
+	Allow(key string) (Result, error)
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const localSweepInterval = time.Minute
+
+// NewLocal creates a token bucket limiter that keeps the buckets in memory, so
+// each instance of a service limits requests independently.
+func NewLocal(limit Limit) (Limiter, error) {
+	limit, err := limit.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &localLimiter{
+		limit:     limit,
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}, nil
+}
+
+type localLimiter struct {
+	limit Limit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (l *localLimiter) Allow(key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > localSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(l.limit, now)
+
+	result := Result{Limit: l.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = tokensDuration(l.limit, 1-b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = tokensDuration(l.limit, float64(l.limit.Burst)-b.tokens)
+	return result, nil
+}
+
+// sweep removes full buckets, which are the same as missing ones.
+func (l *localLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(l.limit, now); b.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *bucket) refill(limit Limit, now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += float64(elapsed) / float64(limit.interval())
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.updated = now
+}
+
+func tokensDuration(limit Limit, tokens float64) time.Duration {
+	return time.Duration(tokens * float64(limit.interval()))
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	Convey("Local limiter", t, func() {
+		now := time.Now()
+		limiter, err := NewLocal(Limit{Rate: 2, Period: time.Second, Burst: 3})
+		So(err, ShouldBeNil)
+		limiter.(*localLimiter).now = func() time.Time { return now }
+
+		Convey("It should allow bursts", func() {
+			for i := 2; i >= 0; i-- {
+				result, err := limiter.Allow("key")
+				So(err, ShouldBeNil)
+				So(result.Allowed, ShouldBeTrue)
+				So(result.Remaining, ShouldEqual, i)
+				So(result.Limit, ShouldEqual, 3)
+			}
+
+			result, _ := limiter.Allow("key")
+			So(result.Allowed, ShouldBeFalse)
+			So(result.RetryAfter, ShouldEqual, 500*time.Millisecond)
+			So(result.ResetAfter, ShouldEqual, 1500*time.Millisecond)
+		})
+
+		Convey("It should refill at the rate", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Allow("key")
+			}
+
+			now = now.Add(500 * time.Millisecond)
+			result, _ := limiter.Allow("key")
+			So(result.Allowed, ShouldBeTrue)
+			result, _ = limiter.Allow("key")
+			So(result.Allowed, ShouldBeFalse)
+		})
+
+		Convey("It should limit keys independently", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Allow("key")
+			}
+			result, _ := limiter.Allow("other")
+			So(result.Allowed, ShouldBeTrue)
+		})
+
+		Convey("It should sweep full buckets", func() {
+			limiter.Allow("key")
+			now = now.Add(2 * localSweepInterval)
+			limiter.Allow("other")
+			So(limiter.(*localLimiter).buckets, ShouldContainKey, "other")
+			So(limiter.(*localLimiter).buckets, ShouldNotContainKey, "key")
+		})
+	})
+
+	Convey("Limit", t, func() {
+		_, err := NewLocal(Limit{Rate: 0, Period: time.Second})
+		So(err, ShouldNotBeNil)
+		_, err = NewLocal(PerMinute(10))
+		So(err, ShouldBeNil)
+	})
+}
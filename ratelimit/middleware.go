@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyFunc returns the key identifying the requester, e.g. a client IP or an
+// account name.
+type KeyFunc func(c *gin.Context) string
+
+// ByClientIP limits requests per client IP.
+func ByClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// Middleware rejects requests exceeding the limit with 429 Too Many Requests and
+// a Retry-After header. All responses get the RateLimit-Limit, -Remaining and
+// -Reset headers from the IETF draft on rate limit headers. Requests are let
+// through if the limiter fails, since it is not worth to make the service
+// unavailable because of that.
+func Middleware(limiter Limiter, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+		result, err := limiter.Allow(key)
+		if err != nil {
+			logrus.WithError(err).
+				WithFields(logrus.Fields{
+					"code":     "rate_limit_error",
+					"category": "rate_limit",
+					"key":      key,
+				}).Error("Error checking rate limit, allowing request")
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+		if !result.Allowed {
+			header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(key string) (Result, error) {
+	return Result{}, errors.New("I am expected")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(limiter Limiter) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(Middleware(limiter, ByClientIP))
+		router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder
+	}
+
+	Convey("Middleware", t, func() {
+		limiter, _ := NewLocal(PerMinute(1))
+
+		Convey("It should set rate limit headers", func() {
+			response := serve(limiter)
+			So(response.Code, ShouldEqual, http.StatusOK)
+			So(response.Header().Get("RateLimit-Limit"), ShouldEqual, "1")
+			So(response.Header().Get("RateLimit-Remaining"), ShouldEqual, "0")
+			So(response.Header().Get("RateLimit-Reset"), ShouldEqual, "60")
+		})
+
+		Convey("It should reject requests over the limit", func() {
+			serve(limiter)
+			response := serve(limiter)
+			So(response.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(response.Header().Get("Retry-After"), ShouldEqual, "60")
+		})
+
+		Convey("It should allow requests if the limiter fails", func() {
+			response := serve(failingLimiter{})
+			So(response.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/redis"
+)
+
+// gcraScript implements the generic cell rate algorithm, storing for each key
+// the theoretical arrival time (TAT) of the next request, in microseconds. The
+// time is taken from Redis, so that clocks of clients don't need to agree.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1])) or now
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local diff = now - (new_tat - interval * burst)
+if diff < 0 then
+	return {0, 0, -diff, tat - now}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", KEYS[1], string.format("%.0f", new_tat), "PX", math.max(1, math.ceil(reset_after / 1000)))
+return {1, math.floor(diff / interval), 0, reset_after}
+`)
+
+const redisKeyPrefix = "goio.ratelimit:"
+
+// NewRedis creates a limiter shared by all instances using the given Redis,
+// which allows requests evenly spaced in time with GCRA, besides bursts. Keys
+// expire as soon as their limit is fully available again.
+func NewRedis(client redis.Scripter, limit Limit) (Limiter, error) {
+	limit, err := limit.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &redisLimiter{client: client, limit: limit}, nil
+}
+
+type redisLimiter struct {
+	client redis.Scripter
+	limit  Limit
+}
+
+func (l *redisLimiter) Allow(key string) (Result, error) {
+	interval := l.limit.interval().Microseconds()
+	reply, err := l.client.Eval(gcraScript, []string{redisKeyPrefix + key}, interval, l.limit.Burst)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "Failed to check rate limit for %s", key)
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return Result{}, errors.Errorf("Unexpected rate limit script reply: %v", reply)
+	}
+	ints := make([]int64, len(values))
+	for i, value := range values {
+		if ints[i], ok = value.(int64); !ok {
+			return Result{}, errors.Errorf("Unexpected rate limit script reply: %v", reply)
+		}
+	}
+
+	return Result{
+		Allowed:    ints[0] == 1,
+		Limit:      l.limit.Burst,
+		Remaining:  int(ints[1]),
+		RetryAfter: time.Duration(ints[2]) * time.Microsecond,
+		ResetAfter: time.Duration(ints[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/vtex/go-io/redis"
+	"github.com/vtex/go-io/redis/testUtils"
+)
+
+// fakeGCRA implements gcraScript for the fake server, taking the time from it.
+func fakeGCRA(s *testUtils.FakeServer, keys, args []string) interface{} {
+	interval, _ := strconv.ParseInt(args[0], 10, 64)
+	burst, _ := strconv.ParseInt(args[1], 10, 64)
+	now := s.Now().UnixMicro()
+
+	tat := now
+	if value, ok := s.Get(keys[0]); ok {
+		tat, _ = strconv.ParseInt(string(value), 10, 64)
+	}
+	if tat < now {
+		tat = now
+	}
+
+	newTat := tat + interval
+	diff := now - (newTat - interval*burst)
+	if diff < 0 {
+		return []interface{}{int64(0), int64(0), -diff, tat - now}
+	}
+
+	resetAfter := newTat - now
+	ttl := (resetAfter + 999) / 1000
+	if ttl < 1 {
+		ttl = 1
+	}
+	s.Set(keys[0], []byte(strconv.FormatInt(newTat, 10)), time.Duration(ttl)*time.Millisecond)
+	return []interface{}{int64(1), diff / interval, int64(0), resetAfter}
+}
+
+func TestRedisLimiter(t *testing.T) {
+	Convey("Redis limiter", t, func() {
+		server := testUtils.NewFakeServer(t)
+		server.AddScript(gcraScript.Hash(), fakeGCRA)
+		client := redis.New(redis.RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test"}).(redis.Scripter)
+
+		limiter, err := NewRedis(client, Limit{Rate: 2, Period: time.Second, Burst: 3})
+		So(err, ShouldBeNil)
+
+		Convey("It should allow bursts", func() {
+			for i := 2; i >= 0; i-- {
+				result, err := limiter.Allow("key")
+				So(err, ShouldBeNil)
+				So(result.Allowed, ShouldBeTrue)
+				So(result.Remaining, ShouldEqual, i)
+				So(result.Limit, ShouldEqual, 3)
+			}
+			So(server.LastArgs("EVALSHA")[2], ShouldEqual, "test:goio.ratelimit:key")
+
+			result, err := limiter.Allow("key")
+			So(err, ShouldBeNil)
+			So(result.Allowed, ShouldBeFalse)
+			So(result.Remaining, ShouldEqual, 0)
+			So(result.RetryAfter, ShouldAlmostEqual, 500*time.Millisecond, 50*time.Millisecond)
+			So(result.ResetAfter, ShouldAlmostEqual, 1500*time.Millisecond, 50*time.Millisecond)
+		})
+
+		Convey("It should allow requests again after the retry time", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Allow("key")
+			}
+			result, _ := limiter.Allow("key")
+			So(result.Allowed, ShouldBeFalse)
+
+			server.Advance(result.RetryAfter)
+			result, err := limiter.Allow("key")
+			So(err, ShouldBeNil)
+			So(result.Allowed, ShouldBeTrue)
+			So(result.Remaining, ShouldEqual, 0)
+		})
+
+		Convey("It should expire keys once the limit is fully available", func() {
+			result, _ := limiter.Allow("key")
+			So(result.ResetAfter, ShouldAlmostEqual, 500*time.Millisecond, 50*time.Millisecond)
+
+			server.Advance(result.ResetAfter + time.Millisecond)
+			exists, err := client.Exists(redisKeyPrefix + "key")
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+
+		Convey("It should limit keys independently", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Allow("key")
+			}
+			result, _ := limiter.Allow("other")
+			So(result.Allowed, ShouldBeTrue)
+		})
+
+		Convey("It should load the script only when Redis doesn't have it", func() {
+			limiter.Allow("key")
+			limiter.Allow("key")
+			So(server.Calls("EVAL"), ShouldEqual, 1)
+
+			server.FlushScripts()
+			result, err := limiter.Allow("key")
+			So(err, ShouldBeNil)
+			So(result.Allowed, ShouldBeTrue)
+			So(server.Calls("EVAL"), ShouldEqual, 2)
+		})
+
+		Convey("It should return errors running the script", func() {
+			server.Fail("ERR Error running script", "EVALSHA")
+			_, err := limiter.Allow("key")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -2,10 +2,10 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
 	"strings"
-
+	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -21,13 +21,65 @@ const (
 
 type TimeTracker func(kpiName string, startTime time.Time)
 
+// ReadRouting defines which nodes serve read-only commands in cluster mode.
+type ReadRouting int
+
+const (
+	// ReadFromMaster sends all commands to the masters of their slots.
+	ReadFromMaster ReadRouting = iota
+	// ReadFromReplicas spreads reads randomly among the master and replicas of
+	// their slots, which may return values outdated by the replication lag.
+	ReadFromReplicas
+	// ReadByLatency sends reads to the node with the lowest latency among the
+	// master and replicas of their slots, with the same caveat.
+	ReadByLatency
+)
+
 type RedisConfig struct {
-	Endpoint       string
-	ClusterMode    bool
-	KeyNamespace   string
-	TimeTracker    TimeTracker
+	Endpoint string
+	// Endpoints are additional seed nodes for discovering the cluster, so that
+	// it can be reached when some of the nodes are down. Only used in cluster
+	// mode, where Endpoint may be left empty.
+	Endpoints    []string
+	ClusterMode  bool
+	ReadRouting  ReadRouting
+	KeyNamespace string
+	TimeTracker  TimeTracker
+	// MaxIdleConns and MaxActiveConns default to 10 and 20, except in cluster
+	// mode, where the defaults of the cluster client apply.
 	MaxIdleConns   int
 	MaxActiveConns int
+
+	// Username is only needed for Redis 6 ACL users other than the default.
+	Username string
+	Password string
+	// DB is the database selected by connections. It is ignored in cluster mode,
+	// which only supports database 0.
+	DB int
+	// TLSConfig enables TLS when set (see NewTLSConfig). The server name defaults
+	// to the host in Endpoint.
+	TLSConfig *tls.Config
+
+	// SentinelMasterName enables Sentinel mode, in which connections are made to
+	// the current master of the given name, as resolved by the sentinels at
+	// SentinelAddrs, instead of to Endpoint. It is ignored in cluster mode.
+	SentinelMasterName string
+	SentinelAddrs      []string
+	SentinelPassword   string
+
+	// Timeouts default to 1s for dialing and 200ms for reading and writing.
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// CommandTimeouts overrides ReadTimeout for specific commands, indexed by
+	// their case insensitive names, e.g. {"EVAL": 5 * time.Second}.
+	CommandTimeouts map[string]time.Duration
+	// IdlePingThreshold is how long a connection can be idle before being
+	// checked with a PING when taken from the pool. Defaults to 30s.
+	IdlePingThreshold time.Duration
+	// IdleTimeout is how long a connection can be idle before being closed.
+	// Defaults to 3min.
+	IdleTimeout time.Duration
 }
 
 type SetOptions struct {
@@ -43,42 +95,151 @@ type Cache interface {
 	Incr(key string) (int64, error)
 }
 
+// New creates a client for the Redis deployment described by conf. The client
+// also implements io.Closer, whose Close releases its connections and, in
+// Sentinel mode, stops watching the sentinels once no other client with the
+// same configuration uses them.
 func New(conf RedisConfig) Cache {
+	conf = conf.withDefaults()
+
+	if conf.ClusterMode {
+		return &redisC{cluster: newClusterClient(conf), conf: conf}
+	}
+
+	var sentinel *sentinelResolver
+	if conf.SentinelMasterName != "" {
+		sentinel = acquireSentinelResolver(conf)
+	}
+
+	pool := newRedisPool(conf.Endpoint, poolOptions{
+		MaxIdle:        conf.MaxIdleConns,
+		MaxActive:      conf.MaxActiveConns,
+		SetReadTimeout: true,
+		Timeouts:       conf.timeouts(),
+		Auth:           conf.auth(),
+		TLSConfig:      conf.TLSConfig,
+		Sentinel:       sentinel,
+	})
+	return &redisC{pool: pool, sentinel: sentinel, conf: conf}
+}
+
+// newClusterClient creates the cluster client for conf, which must have its
+// defaults applied. Commands are bounded by the timeout of their context (see
+// commandContext), so the read timeout of the options, which caps it, is the
+// longest of the command timeouts.
+func newClusterClient(conf RedisConfig) *redisCluster.ClusterClient {
+	readTimeout := conf.ReadTimeout
+	for _, timeout := range conf.CommandTimeouts {
+		if timeout > readTimeout {
+			readTimeout = timeout
+		}
+	}
+
+	return redisCluster.NewClusterClient(
+		&redisCluster.ClusterOptions{
+			Addrs:                 conf.clusterAddrs(),
+			ReadOnly:              conf.ReadRouting != ReadFromMaster,
+			RouteRandomly:         conf.ReadRouting == ReadFromReplicas,
+			RouteByLatency:        conf.ReadRouting == ReadByLatency,
+			DialTimeout:           conf.DialTimeout,
+			ReadTimeout:           readTimeout,
+			WriteTimeout:          conf.WriteTimeout,
+			ContextTimeoutEnabled: true,
+			PoolSize:              conf.MaxActiveConns,
+			MaxIdleConns:          conf.MaxIdleConns,
+			ConnMaxIdleTime:       conf.IdleTimeout,
+			Username:              conf.Username,
+			Password:              conf.Password,
+			TLSConfig:             conf.TLSConfig,
+		},
+	)
+}
+
+func (conf RedisConfig) withDefaults() RedisConfig {
+	if conf.Endpoint == "" && len(conf.Endpoints) > 0 && conf.ClusterMode {
+		// Connections to a single node, as for pub/sub, go to the first seed.
+		conf.Endpoint = conf.Endpoints[0]
+	}
 	if conf.TimeTracker == nil {
 		conf.TimeTracker = func(string, time.Time) {}
 	}
-	if conf.MaxIdleConns == 0 {
+	// The cluster client has its own defaults, proportional to the number of
+	// CPUs and applying to each node.
+	if conf.MaxIdleConns == 0 && !conf.ClusterMode {
 		conf.MaxIdleConns = 10
 	}
-	if conf.MaxActiveConns == 0 {
+	if conf.MaxActiveConns == 0 && !conf.ClusterMode {
 		conf.MaxActiveConns = 20
 	}
 
-	if conf.ClusterMode {
-		cluster := redisCluster.NewClusterClient(
-			&redisCluster.ClusterOptions{
-				Addrs:        []string{conf.Endpoint},
-				ReadTimeout:  200 * time.Millisecond,
-				WriteTimeout: 200 * time.Millisecond,
-				DialTimeout:  1 * time.Second,
-			},
-		)
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = defaultDialTimeout
+	}
+	if conf.ReadTimeout <= 0 {
+		conf.ReadTimeout = defaultReadTimeout
+	}
+	if conf.WriteTimeout <= 0 {
+		conf.WriteTimeout = defaultWriteTimeout
+	}
+	if conf.IdlePingThreshold <= 0 {
+		conf.IdlePingThreshold = defaultIdlePingThreshold
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = defaultIdleConnTimeout
+	}
 
-		return &redisC{cluster: cluster, conf: conf}
+	if len(conf.CommandTimeouts) > 0 {
+		timeouts := make(map[string]time.Duration, len(conf.CommandTimeouts))
+		for cmd, timeout := range conf.CommandTimeouts {
+			timeouts[strings.ToUpper(cmd)] = timeout
+		}
+		conf.CommandTimeouts = timeouts
 	}
+	return conf
+}
 
-	pool := newRedisPool(conf.Endpoint, poolOptions{
-		MaxIdle:        conf.MaxIdleConns,
-		MaxActive:      conf.MaxActiveConns,
-		SetReadTimeout: true,
-	})
-	return &redisC{pool: pool, conf: conf}
+func (conf RedisConfig) clusterAddrs() []string {
+	addrs := make([]string, 0, len(conf.Endpoints)+1)
+	if conf.Endpoint != "" {
+		addrs = append(addrs, conf.Endpoint)
+	}
+	for _, endpoint := range conf.Endpoints {
+		if endpoint != conf.Endpoint {
+			addrs = append(addrs, endpoint)
+		}
+	}
+	return addrs
+}
+
+// commandTimeout returns the read timeout for cmd, and whether it is
+// overridden in CommandTimeouts.
+func (conf RedisConfig) commandTimeout(cmd string) (time.Duration, bool) {
+	if timeout, ok := conf.CommandTimeouts[strings.ToUpper(cmd)]; ok {
+		return timeout, true
+	}
+	return conf.ReadTimeout, false
 }
 
 type redisC struct {
-	pool    *redis.Pool
-	cluster *redisCluster.ClusterClient
-	conf    RedisConfig
+	pool      *redis.Pool
+	cluster   *redisCluster.ClusterClient
+	sentinel  *sentinelResolver
+	conf      RedisConfig
+	closeOnce sync.Once
+}
+
+func (r *redisC) Close() (err error) {
+	r.closeOnce.Do(func() {
+		if r.sentinel != nil {
+			r.sentinel.release()
+		}
+		if r.cluster == nil {
+			err = r.pool.Close()
+			return
+		}
+		err = r.cluster.Close()
+	})
+	return err
 }
 
 func (r *redisC) Get(key string, result interface{}) (bool, error) {
@@ -94,11 +255,8 @@ func (r *redisC) Get(key string, result interface{}) (bool, error) {
 		return false, errors.WithStack(err)
 	}
 
-	if bytesRes, isBytesPtr := result.(*[]byte); isBytesPtr {
-		*bytesRes = reply
-		return true, nil
-	} else if err := json.Unmarshal(reply, result); err != nil {
-		return false, errors.Wrap(err, "Failed to umarshal Redis response")
+	if err := decodeValue(reply, result); err != nil {
+		return false, err
 	}
 	return true, nil
 }
@@ -141,12 +299,9 @@ func (r *redisC) SetOpt(key string, value interface{}, options SetOptions) (bool
 		return false, err
 	}
 
-	bytes, isBytes := value.([]byte)
-	if !isBytes {
-		bytes, err = json.Marshal(value)
-		if err != nil {
-			return false, errors.Wrap(err, "Failed to marshal value for saving to Redis")
-		}
+	bytes, err := encodeValue(value)
+	if err != nil {
+		return false, err
 	}
 
 	cacheDuration := minDuration(options.ExpireIn, maxRedisCacheDuration)
@@ -200,7 +355,9 @@ func (r *redisC) remoteKey(key string) (string, error) {
 func (r *redisC) doCmd(cmd string, args ...interface{}) (interface{}, error) {
 	if r.cluster != nil {
 		defer r.conf.TimeTracker(commandKpiName(cmd), time.Now())
-		result, err := r.cluster.Do(context.Background(), append([]interface{}{cmd}, args...)...).Result()
+		ctx, cancel := r.commandContext(cmd)
+		defer cancel()
+		result, err := r.cluster.Do(ctx, append([]interface{}{cmd}, args...)...).Result()
 		if err == redisCluster.Nil {
 			return result, redis.ErrNil
 		}
@@ -208,10 +365,34 @@ func (r *redisC) doCmd(cmd string, args ...interface{}) (interface{}, error) {
 		return result, err
 	}
 
+	timeout, overridden := r.conf.commandTimeout(cmd)
+	result, err := r.doPoolCmd(timeout, overridden, cmd, args...)
+	if r.sentinel != nil && isReadOnlyError(err) {
+		// The connection is to a master demoted by a failover, so resolve the new
+		// master to discard it and retry, since the command was rejected.
+		if _, resolveErr := r.sentinel.Resolve(); resolveErr != nil {
+			return result, err
+		}
+		return r.doPoolCmd(timeout, overridden, cmd, args...)
+	}
+	return result, err
+}
+
+// commandContext returns the context for running cmd with the cluster client,
+// which times out after the read timeout of cmd.
+func (r *redisC) commandContext(cmd string) (context.Context, context.CancelFunc) {
+	timeout, _ := r.conf.commandTimeout(cmd)
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (r *redisC) doPoolCmd(timeout time.Duration, overridden bool, cmd string, args ...interface{}) (interface{}, error) {
 	conn := r.getConnection()
 	defer r.closeConnection(conn)
 
 	defer r.conf.TimeTracker(commandKpiName(cmd), time.Now())
+	if overridden {
+		return redis.DoWithTimeout(conn, timeout, cmd, args...)
+	}
 	return conn.Do(cmd, args...)
 }
 
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClusterOptions(t *testing.T) {
+	Convey("New in cluster mode", t, func() {
+		conf := RedisConfig{
+			Endpoint:        "127.0.0.1:0",
+			ClusterMode:     true,
+			CommandTimeouts: map[string]time.Duration{"eval": 5 * time.Second},
+		}
+
+		Convey("It should bound reads by the longest command timeout", func() {
+			opts := New(conf).(*redisC).cluster.Options()
+			So(opts.ReadTimeout, ShouldEqual, 5*time.Second)
+			So(opts.WriteTimeout, ShouldEqual, defaultWriteTimeout)
+			So(opts.DialTimeout, ShouldEqual, defaultDialTimeout)
+			So(opts.ContextTimeoutEnabled, ShouldBeTrue)
+
+			conf.CommandTimeouts = nil
+			So(New(conf).(*redisC).cluster.Options().ReadTimeout, ShouldEqual, defaultReadTimeout)
+		})
+
+		Convey("It should time out commands after their own timeout", func() {
+			server := newFakeServer(t)
+			conf.Endpoint = server.Addr()
+			conf.KeyNamespace = "test"
+			conf.ReadTimeout = 50 * time.Millisecond
+			conf.CommandTimeouts = map[string]time.Duration{"exists": time.Second}
+			client := New(conf).(*redisC)
+			defer client.Close()
+			server.Delay(200*time.Millisecond, "GET", "EXISTS")
+
+			var value string
+			_, err := client.Get("key", &value)
+			So(err, ShouldNotBeNil)
+
+			_, err = client.Exists("key")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("It should keep the default pool size of the cluster client", func() {
+			client := New(conf).(*redisC)
+			So(client.cluster.Options().PoolSize, ShouldEqual, 5*runtime.GOMAXPROCS(0))
+
+			conf.MaxActiveConns = 7
+			client = New(conf).(*redisC)
+			So(client.cluster.Options().PoolSize, ShouldEqual, 7)
+		})
+	})
+}
+
+func TestEndpoints(t *testing.T) {
+	Convey("Endpoints", t, func() {
+		conf := RedisConfig{Endpoints: []string{"node1:6379", "node2:6379"}}
+
+		Convey("It should only be used in cluster mode", func() {
+			So(conf.withDefaults().Endpoint, ShouldBeEmpty)
+
+			conf.ClusterMode = true
+			So(conf.withDefaults().Endpoint, ShouldEqual, "node1:6379")
+			So(conf.withDefaults().clusterAddrs(), ShouldResemble, conf.Endpoints)
+		})
+	})
+}
@@ -0,0 +1,294 @@
+package redis
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// Collections is a Cache which also stores hashes, sets and sorted sets. It is
+// kept apart from Cache so that implementations of Cache don't need to support
+// them. The clients returned by New implement it, e.g. New(conf).(Collections).
+//
+// Field values and members follow the same conventions as values: they are
+// stored as JSON, except for []byte, which is stored as is. Notice their keys
+// don't expire.
+type Collections interface {
+	Cache
+	HGet(key, field string, result interface{}) (bool, error)
+	HSet(key, field string, value interface{}) error
+	HGetAll(key string, result interface{}) (bool, error)
+	HIncrBy(key, field string, incr int64) (int64, error)
+	SAdd(key string, members ...interface{}) (int64, error)
+	SIsMember(key string, member interface{}) (bool, error)
+	SMembers(key string, result interface{}) error
+	ZAdd(key string, members ...ZMember) (int64, error)
+	ZRangeByScore(key string, min, max float64, result interface{}) error
+	ZRem(key string, members ...interface{}) (int64, error)
+}
+
+// ZMember is a member of a sorted set with its score.
+type ZMember struct {
+	Score  float64
+	Member interface{}
+}
+
+func (r *redisC) HGet(key, field string, result interface{}) (bool, error) {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	reply, err := r.doCmd("HGET", key, field)
+	if err == redis.ErrNil || (err == nil && reply == nil) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	data, err := replyBytes(reply)
+	if err != nil {
+		return false, err
+	}
+	return true, decodeValue(data, result)
+}
+
+func (r *redisC) HSet(key, field string, value interface{}) error {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	if _, err := r.doCmd("HSET", key, field, data); err != nil {
+		return errors.Wrap(err, "Failed HSET command on Redis")
+	}
+	return nil
+}
+
+// HGetAll decodes all fields of the hash into result, which must be a pointer
+// to a map with string keys, returning false if the hash does not exist.
+func (r *redisC) HGetAll(key string, result interface{}) (bool, error) {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	fields, err := replyBytesMap(r.doCmd("HGETALL", key))
+	if err != nil {
+		return false, errors.WithStack(err)
+	} else if len(fields) == 0 {
+		return false, nil
+	}
+	return true, decodeMap(fields, result)
+}
+
+func (r *redisC) HIncrBy(key, field string, incr int64) (int64, error) {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := redis.Int64(r.doCmd("HINCRBY", key, field, incr))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return val, nil
+}
+
+// SAdd adds the members to the set, returning how many were not already in it.
+func (r *redisC) SAdd(key string, members ...interface{}) (int64, error) {
+	args, err := r.membersArgs(key, members)
+	if err != nil {
+		return 0, err
+	}
+
+	added, err := redis.Int64(r.doCmd("SADD", args...))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed SADD command on Redis")
+	}
+	return added, nil
+}
+
+func (r *redisC) SIsMember(key string, member interface{}) (bool, error) {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := encodeValue(member)
+	if err != nil {
+		return false, err
+	}
+	isMember, err := redis.Bool(r.doCmd("SISMEMBER", key, data))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return isMember, nil
+}
+
+// SMembers decodes the members of the set into result, which must be a pointer
+// to a slice. The order of the members is undefined.
+func (r *redisC) SMembers(key string, result interface{}) error {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return err
+	}
+
+	members, err := replyByteSlices(r.doCmd("SMEMBERS", key))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeSlice(members, result)
+}
+
+// ZAdd adds the members to the sorted set, or updates their scores if already
+// in it, returning how many were added.
+func (r *redisC) ZAdd(key string, members ...ZMember) (int64, error) {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return 0, err
+	} else if len(members) == 0 {
+		return 0, errors.New("Must send at least one member to add")
+	}
+
+	args := make([]interface{}, 0, 1+2*len(members))
+	args = append(args, key)
+	for _, member := range members {
+		data, err := encodeValue(member.Member)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, formatScore(member.Score), data)
+	}
+
+	added, err := redis.Int64(r.doCmd("ZADD", args...))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed ZADD command on Redis")
+	}
+	return added, nil
+}
+
+// ZRangeByScore decodes the members of the sorted set with scores between min
+// and max, inclusive, into result, which must be a pointer to a slice. Members
+// are ordered by score, and min and max may be infinite.
+func (r *redisC) ZRangeByScore(key string, min, max float64, result interface{}) error {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return err
+	}
+
+	members, err := replyByteSlices(r.doCmd("ZRANGEBYSCORE", key, formatScore(min), formatScore(max)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeSlice(members, result)
+}
+
+// ZRem removes the members from the sorted set, returning how many were in it.
+func (r *redisC) ZRem(key string, members ...interface{}) (int64, error) {
+	args, err := r.membersArgs(key, members)
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := redis.Int64(r.doCmd("ZREM", args...))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed ZREM command on Redis")
+	}
+	return removed, nil
+}
+
+func (r *redisC) membersArgs(key string, members []interface{}) ([]interface{}, error) {
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return nil, err
+	} else if len(members) == 0 {
+		return nil, errors.New("Must send at least one member")
+	}
+
+	args := make([]interface{}, 0, 1+len(members))
+	args = append(args, key)
+	for _, member := range members {
+		data, err := encodeValue(member)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, data)
+	}
+	return args, nil
+}
+
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "+inf"
+	} else if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// encodeValue and decodeValue implement the conventions for values stored in
+// Redis: []byte is stored as is, and anything else as JSON.
+func encodeValue(value interface{}) ([]byte, error) {
+	if bytes, isBytes := value.([]byte); isBytes {
+		return bytes, nil
+	}
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal value for saving to Redis")
+	}
+	return bytes, nil
+}
+
+func decodeValue(data []byte, result interface{}) error {
+	if bytesRes, isBytesPtr := result.(*[]byte); isBytesPtr {
+		*bytesRes = data
+		return nil
+	} else if err := json.Unmarshal(data, result); err != nil {
+		return errors.Wrap(err, "Failed to umarshal Redis response")
+	}
+	return nil
+}
+
+func decodeSlice(values [][]byte, result interface{}) error {
+	resultRv := reflect.ValueOf(result)
+	if resultRv.Kind() != reflect.Ptr || resultRv.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("Result must be a pointer to a slice, got %T", result)
+	}
+
+	slice := reflect.MakeSlice(resultRv.Elem().Type(), len(values), len(values))
+	for i, data := range values {
+		if err := decodeValue(data, slice.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	resultRv.Elem().Set(slice)
+	return nil
+}
+
+func decodeMap(values map[string][]byte, result interface{}) error {
+	resultRv := reflect.ValueOf(result)
+	if resultRv.Kind() != reflect.Ptr || resultRv.Elem().Kind() != reflect.Map || resultRv.Elem().Type().Key().Kind() != reflect.String {
+		return errors.Errorf("Result must be a pointer to a map with string keys, got %T", result)
+	}
+
+	mapType := resultRv.Elem().Type()
+	m := reflect.MakeMapWithSize(mapType, len(values))
+	for key, data := range values {
+		value := reflect.New(mapType.Elem())
+		if err := decodeValue(data, value.Interface()); err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(mapType.Key()), value.Elem())
+	}
+	resultRv.Elem().Set(m)
+	return nil
+}
@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type collectionItem struct {
+	Name string
+}
+
+func TestCollections(t *testing.T) {
+	for _, clusterMode := range []bool{false, true} {
+		Convey("Collections", t, func() {
+			server := newFakeServer(t)
+			conf := RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test", ClusterMode: clusterMode}
+			client := New(conf)
+			defer client.(*redisC).Close()
+			subject, ok := client.(Collections)
+			So(ok, ShouldBeTrue)
+
+			Convey("Hashes", func() {
+				Convey("It should get fields set as JSON or bytes", func() {
+					So(subject.HSet("hash", "json", collectionItem{"a"}), ShouldBeNil)
+					So(subject.HSet("hash", "bytes", []byte("raw")), ShouldBeNil)
+					So(server.LastArgs("HSET"), ShouldResemble, []string{"test:hash", "bytes", "raw"})
+
+					var item collectionItem
+					found, err := subject.HGet("hash", "json", &item)
+					So(err, ShouldBeNil)
+					So(found, ShouldBeTrue)
+					So(item, ShouldResemble, collectionItem{"a"})
+
+					var data []byte
+					found, err = subject.HGet("hash", "bytes", &data)
+					So(err, ShouldBeNil)
+					So(found, ShouldBeTrue)
+					So(string(data), ShouldEqual, "raw")
+				})
+
+				Convey("It should report missing fields and hashes", func() {
+					So(subject.HSet("hash", "field", 1), ShouldBeNil)
+
+					var value int
+					found, err := subject.HGet("hash", "missing", &value)
+					So(err, ShouldBeNil)
+					So(found, ShouldBeFalse)
+
+					found, err = subject.HGet("missing", "field", &value)
+					So(err, ShouldBeNil)
+					So(found, ShouldBeFalse)
+
+					var all map[string]int
+					found, err = subject.HGetAll("missing", &all)
+					So(err, ShouldBeNil)
+					So(found, ShouldBeFalse)
+					So(all, ShouldBeNil)
+				})
+
+				Convey("It should get all fields", func() {
+					So(subject.HSet("hash", "a", collectionItem{"a"}), ShouldBeNil)
+					So(subject.HSet("hash", "b", collectionItem{"b"}), ShouldBeNil)
+
+					var all map[string]collectionItem
+					found, err := subject.HGetAll("hash", &all)
+					So(err, ShouldBeNil)
+					So(found, ShouldBeTrue)
+					So(all, ShouldResemble, map[string]collectionItem{"a": {"a"}, "b": {"b"}})
+
+					var notMap []string
+					_, err = subject.HGetAll("hash", &notMap)
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("It should increment fields, starting from zero", func() {
+					n, err := subject.HIncrBy("hash", "counter", 2)
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 2)
+
+					n, err = subject.HIncrBy("hash", "counter", -5)
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, -3)
+				})
+			})
+
+			Convey("Sets", func() {
+				Convey("It should add members once", func() {
+					added, err := subject.SAdd("set", "a", "b")
+					So(err, ShouldBeNil)
+					So(added, ShouldEqual, 2)
+
+					added, err = subject.SAdd("set", "b", "c")
+					So(err, ShouldBeNil)
+					So(added, ShouldEqual, 1)
+
+					var members []string
+					So(subject.SMembers("set", &members), ShouldBeNil)
+					sort.Strings(members)
+					So(members, ShouldResemble, []string{"a", "b", "c"})
+				})
+
+				Convey("It should check membership", func() {
+					_, err := subject.SAdd("set", collectionItem{"a"})
+					So(err, ShouldBeNil)
+
+					isMember, err := subject.SIsMember("set", collectionItem{"a"})
+					So(err, ShouldBeNil)
+					So(isMember, ShouldBeTrue)
+
+					isMember, err = subject.SIsMember("set", collectionItem{"b"})
+					So(err, ShouldBeNil)
+					So(isMember, ShouldBeFalse)
+
+					isMember, err = subject.SIsMember("missing", collectionItem{"a"})
+					So(err, ShouldBeNil)
+					So(isMember, ShouldBeFalse)
+				})
+
+				Convey("It should have no members for missing sets", func() {
+					members := []string{"stale"}
+					So(subject.SMembers("missing", &members), ShouldBeNil)
+					So(members, ShouldBeEmpty)
+				})
+
+				Convey("It should require members", func() {
+					_, err := subject.SAdd("set")
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("Sorted sets", func() {
+				Convey("It should range members by score", func() {
+					added, err := subject.ZAdd("zset", ZMember{3, "c"}, ZMember{1, "a"}, ZMember{2.5, "b"})
+					So(err, ShouldBeNil)
+					So(added, ShouldEqual, 3)
+					So(server.LastArgs("ZADD"), ShouldResemble, []string{"test:zset", "3", `"c"`, "1", `"a"`, "2.5", `"b"`})
+
+					var members []string
+					So(subject.ZRangeByScore("zset", 1, 2.5, &members), ShouldBeNil)
+					So(members, ShouldResemble, []string{"a", "b"})
+
+					So(subject.ZRangeByScore("zset", math.Inf(-1), math.Inf(1), &members), ShouldBeNil)
+					So(members, ShouldResemble, []string{"a", "b", "c"})
+					So(server.LastArgs("ZRANGEBYSCORE"), ShouldResemble, []string{"test:zset", "-inf", "+inf"})
+				})
+
+				Convey("It should update scores of existing members", func() {
+					_, err := subject.ZAdd("zset", ZMember{1, "a"}, ZMember{2, "b"})
+					So(err, ShouldBeNil)
+					added, err := subject.ZAdd("zset", ZMember{3, "a"})
+					So(err, ShouldBeNil)
+					So(added, ShouldEqual, 0)
+
+					var members []string
+					So(subject.ZRangeByScore("zset", 0, 10, &members), ShouldBeNil)
+					So(members, ShouldResemble, []string{"b", "a"})
+				})
+
+				Convey("It should remove members", func() {
+					_, err := subject.ZAdd("zset", ZMember{1, "a"}, ZMember{2, "b"})
+					So(err, ShouldBeNil)
+
+					removed, err := subject.ZRem("zset", "a", "missing")
+					So(err, ShouldBeNil)
+					So(removed, ShouldEqual, 1)
+
+					removed, err = subject.ZRem("missing", "a")
+					So(err, ShouldBeNil)
+					So(removed, ShouldEqual, 0)
+				})
+
+				Convey("It should have no members for missing sorted sets", func() {
+					var members []string
+					So(subject.ZRangeByScore("missing", 0, 10, &members), ShouldBeNil)
+					So(members, ShouldBeEmpty)
+				})
+
+				Convey("It should require members", func() {
+					_, err := subject.ZAdd("zset")
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("It should return errors replied by Redis", func() {
+				server.Fail("WRONGTYPE Operation against a key holding the wrong kind of value", "HGET", "SMEMBERS")
+
+				var value int
+				_, err := subject.HGet("hash", "field", &value)
+				So(err, ShouldNotBeNil)
+
+				var members []int
+				So(subject.SMembers("set", &members), ShouldNotBeNil)
+			})
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/cache"
+	"github.com/vtex/go-io/reflext"
+)
+
+const (
+	fillLeasePrefix  = "goio.fill.lease:"
+	fillNotifyPrefix = "goio.fill.done:"
+
+	defaultFillLeaseTTL     = 5 * time.Second
+	defaultFillWaitTimeout  = 5 * time.Second
+	defaultFillPollInterval = 100 * time.Millisecond
+)
+
+// acquireLeaseScript sets the lease with a TTL in milliseconds, which SetOpt
+// would round down to seconds.
+var acquireLeaseScript = NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// FillOptions configures the behavior of WithDistributedFill.
+type FillOptions struct {
+	// LeaseTTL is how long an instance holds the exclusivity for filling a key,
+	// with millisecond precision. Defaults to 5s.
+	LeaseTTL time.Duration
+	// WaitTimeout is how long other instances wait for the value to show up in
+	// the cache before giving up and fetching it themselves.
+	WaitTimeout time.Duration
+	// PollInterval is how often waiting instances check the cache for the value.
+	PollInterval time.Duration
+	// PubSub is optional and, when present, is used for notifying waiting
+	// instances as soon as the value is filled instead of relying only on polling.
+	PubSub PubSub
+}
+
+// WithDistributedFill returns a cache whose GetOrSet deduplicates the fetches
+// on misses across all instances sharing the same Redis. The first instance to
+// miss acquires a short lease on the key and fetches the value, while the others
+// wait for it to appear in the storage. If the wait times out or the lease holder
+// fails, the waiting instances fall back to fetching the value themselves.
+//
+// The storage cache must be shared between the instances for this to be useful,
+// e.g. a Redis cache or a Hybrid one with a Redis remote tier.
+func WithDistributedFill(storage cache.Cache, leases Scripter, opts FillOptions) cache.Cache {
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = defaultFillLeaseTTL
+	} else if opts.LeaseTTL < time.Millisecond {
+		opts.LeaseTTL = time.Millisecond
+	}
+	if opts.WaitTimeout <= 0 {
+		opts.WaitTimeout = defaultFillWaitTimeout
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultFillPollInterval
+	}
+	return &distributedFill{storage: storage, leases: leases, opts: opts}
+}
+
+type distributedFill struct {
+	storage cache.Cache
+	leases  Scripter
+	opts    FillOptions
+}
+
+func (d *distributedFill) Get(key string, result interface{}) (bool, error) {
+	return d.storage.Get(key, result)
+}
+
+func (d *distributedFill) GetWithInfo(key string, result interface{}) (cache.Info, error) {
+	return cache.GetWithInfo(d.storage, key, result)
+}
+
+func (d *distributedFill) Set(key string, value interface{}, duration time.Duration) error {
+	return d.storage.Set(key, value, duration)
+}
+
+func (d *distributedFill) GetOrSet(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	if key == "" {
+		return errors.Errorf("Cache key must not be empty")
+	}
+
+	if ok, err := d.storage.Get(key, result); ok {
+		return nil
+	} else if err != nil {
+		logError(err, "distributed_fill_get_error", "", key, "Error getting data from cache")
+	}
+
+	// The lease holds a random owner, so that a holder whose fetch outlasts the
+	// lease doesn't release the lease of the next holder.
+	leaseKey := fillLeasePrefix + key
+	owner, err := newLockOwner()
+	if err != nil {
+		logError(err, "distributed_fill_lease_error", "", key, "Error acquiring fill lease, fetching locally")
+		return d.fill(key, result, duration, fetch)
+	}
+	acquired, err := evalInt64(d.leases, acquireLeaseScript, []string{leaseKey}, owner, d.opts.LeaseTTL.Milliseconds())
+	if err != nil {
+		logError(err, "distributed_fill_lease_error", "", key, "Error acquiring fill lease, fetching locally")
+		return d.fill(key, result, duration, fetch)
+	}
+	if acquired == 1 {
+		defer d.releaseLease(key, leaseKey, owner)
+		return d.fill(key, result, duration, fetch)
+	}
+
+	if filled := d.waitFill(key, leaseKey, result); filled {
+		return nil
+	}
+	return d.fill(key, result, duration, fetch)
+}
+
+func (d *distributedFill) fill(key string, result interface{}, duration time.Duration, fetch func() (interface{}, error)) error {
+	value, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	if err := d.storage.Set(key, value, duration); err != nil {
+		logError(err, "distributed_fill_set_error", "", key, "Error saving fetched data to cache")
+	} else if d.opts.PubSub != nil {
+		if err := d.opts.PubSub.Publish(fillNotifyPrefix+key, nil); err != nil {
+			logError(err, "distributed_fill_notify_error", "", key, "Error notifying waiting instances of fill")
+		}
+	}
+	return reflext.SetPointer(result, value)
+}
+
+func (d *distributedFill) releaseLease(key, leaseKey, owner string) {
+	if _, err := d.leases.Eval(releaseLockScript, []string{leaseKey}, owner); err != nil {
+		logError(err, "distributed_fill_release_error", "", key, "Error releasing fill lease")
+	}
+}
+
+// waitFill waits for another instance to fill the key, returning whether the
+// value was found in the storage. It returns early if the lease is released
+// without the value being stored, which means the lease holder failed.
+func (d *distributedFill) waitFill(key, leaseKey string, result interface{}) bool {
+	var notifyCh SubChan
+	if d.opts.PubSub != nil {
+		sub, err := d.opts.PubSub.Subscribe([]string{fillNotifyPrefix + key})
+		if err != nil {
+			logError(err, "distributed_fill_subscribe_error", "", key, "Error subscribing to fill notifications")
+		} else {
+			notifyCh = sub
+			defer d.opts.PubSub.Unsubscribe(sub)
+		}
+	}
+
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	timeout := time.After(d.opts.WaitTimeout)
+
+	for {
+		select {
+		case <-notifyCh:
+		case <-ticker.C:
+		case <-timeout:
+			return false
+		}
+
+		if ok, err := d.storage.Get(key, result); ok {
+			return true
+		} else if err != nil {
+			logError(err, "distributed_fill_get_error", "", key, "Error getting data from cache")
+		}
+
+		if leased, err := d.leases.Exists(leaseKey); err == nil && !leased {
+			// The value may have been stored right before the lease was released.
+			ok, _ := d.storage.Get(key, result)
+			return ok
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDistributedFill(t *testing.T) {
+	Convey("DistributedFill", t, func() {
+		server := newFakeServer(t)
+		client := New(RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test"}).(Scripter)
+		opts := FillOptions{LeaseTTL: time.Second, WaitTimeout: 2 * time.Second, PollInterval: 10 * time.Millisecond}
+		subject := WithDistributedFill(client, client, opts)
+
+		key := "distributed_fill"
+		leaseKey := fillLeasePrefix + key
+		duration := time.Minute
+
+		fetches := 0
+		fetch := func() (interface{}, error) {
+			fetches++
+			return 42, nil
+		}
+
+		Convey("It should fetch and store the value on misses, releasing the lease", func() {
+			var result int
+			So(subject.GetOrSet(key, &result, duration, fetch), ShouldBeNil)
+			So(result, ShouldEqual, 42)
+			So(fetches, ShouldEqual, 1)
+
+			leased, err := client.Exists(leaseKey)
+			So(err, ShouldBeNil)
+			So(leased, ShouldBeFalse)
+
+			So(subject.GetOrSet(key, &result, duration, fetch), ShouldBeNil)
+			So(fetches, ShouldEqual, 1)
+		})
+
+		Convey("It should not release a lease acquired by another instance", func() {
+			var result int
+			err := subject.GetOrSet(key, &result, duration, func() (interface{}, error) {
+				// The fetch outlasts the lease, which another instance acquires.
+				server.Advance(2 * opts.LeaseTTL)
+				acquired, err := client.SetOpt(leaseKey, []byte("other"), SetOptions{ExpireIn: time.Minute, IfNotExist: true})
+				So(err, ShouldBeNil)
+				So(acquired, ShouldBeTrue)
+				return fetch()
+			})
+			So(err, ShouldBeNil)
+
+			var owner []byte
+			leased, err := client.Get(leaseKey, &owner)
+			So(err, ShouldBeNil)
+			So(leased, ShouldBeTrue)
+			So(string(owner), ShouldEqual, "other")
+		})
+
+		Convey("With the lease held by another instance", func() {
+			_, err := client.SetOpt(leaseKey, []byte("other"), SetOptions{ExpireIn: opts.LeaseTTL, IfNotExist: true})
+			So(err, ShouldBeNil)
+
+			Convey("It should wait for the value filled by the lease holder", func() {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					client.Set(key, 7, duration)
+				}()
+
+				var result int
+				So(subject.GetOrSet(key, &result, duration, fetch), ShouldBeNil)
+				So(result, ShouldEqual, 7)
+				So(fetches, ShouldEqual, 0)
+			})
+
+			Convey("It should fetch the value when the lease expires without it being filled", func() {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					server.Advance(opts.LeaseTTL)
+				}()
+
+				start := time.Now()
+				var result int
+				So(subject.GetOrSet(key, &result, duration, fetch), ShouldBeNil)
+				So(result, ShouldEqual, 42)
+				So(fetches, ShouldEqual, 1)
+				So(time.Since(start), ShouldBeLessThan, opts.WaitTimeout)
+			})
+
+			Convey("It should fetch the value when the wait times out", func() {
+				_, err := client.SetOpt(leaseKey, []byte("other"), SetOptions{ExpireIn: time.Minute})
+				So(err, ShouldBeNil)
+
+				subject := WithDistributedFill(client, client, FillOptions{WaitTimeout: 100 * time.Millisecond, PollInterval: 10 * time.Millisecond})
+				var result int
+				So(subject.GetOrSet(key, &result, duration, fetch), ShouldBeNil)
+				So(result, ShouldEqual, 42)
+				So(fetches, ShouldEqual, 1)
+			})
+		})
+
+		Convey("It should hold leases for their duration in milliseconds", func() {
+			subject := WithDistributedFill(client, client, FillOptions{LeaseTTL: 1500 * time.Millisecond})
+			var result int
+			err := subject.GetOrSet(key, &result, duration, func() (interface{}, error) {
+				args := server.LastArgs("EVAL")
+				So(args[len(args)-1], ShouldEqual, "1500")
+
+				server.Advance(1400 * time.Millisecond)
+				leased, err := client.Exists(leaseKey)
+				So(err, ShouldBeNil)
+				So(leased, ShouldBeTrue)
+
+				server.Advance(200 * time.Millisecond)
+				leased, err = client.Exists(leaseKey)
+				So(err, ShouldBeNil)
+				So(leased, ShouldBeFalse)
+				return fetch()
+			})
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, 42)
+		})
+
+		Convey("It should raise lease durations shorter than a millisecond", func() {
+			subject := WithDistributedFill(client, client, FillOptions{LeaseTTL: time.Microsecond})
+			So(subject.(*distributedFill).opts.LeaseTTL, ShouldEqual, time.Millisecond)
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vtex/go-io/redis/testUtils"
+)
+
+type fakeServer = testUtils.FakeServer
+
+// newFakeServer starts a fake server implementing the scripts of the package.
+func newFakeServer(t *testing.T) *fakeServer {
+	server := testUtils.NewFakeServer(t)
+	server.AddScript(releaseLockScript.Hash(), func(s *fakeServer, keys, args []string) interface{} {
+		if value, ok := s.Get(keys[0]); ok && string(value) == args[0] {
+			s.Del(keys[0])
+			return int64(1)
+		}
+		return int64(0)
+	})
+	server.AddScript(acquireLockScript.Hash(), func(s *fakeServer, keys, args []string) interface{} {
+		if _, ok := s.Get(keys[0]); ok {
+			return int64(0)
+		}
+		ttl, _ := strconv.Atoi(args[1])
+		s.Set(keys[0], []byte(args[0]), time.Duration(ttl)*time.Millisecond)
+		return s.Incr(keys[1])
+	})
+	server.AddScript(acquireLeaseScript.Hash(), func(s *fakeServer, keys, args []string) interface{} {
+		if _, ok := s.Get(keys[0]); ok {
+			return int64(0)
+		}
+		ttl, _ := strconv.Atoi(args[1])
+		s.Set(keys[0], []byte(args[0]), time.Duration(ttl)*time.Millisecond)
+		return int64(1)
+	})
+	server.AddScript(renewLockScript.Hash(), func(s *fakeServer, keys, args []string) interface{} {
+		if value, ok := s.Get(keys[0]); ok && string(value) == args[0] {
+			ttl, _ := strconv.Atoi(args[1])
+			s.Set(keys[0], value, time.Duration(ttl)*time.Millisecond)
+			return int64(1)
+		}
+		return int64(0)
+	})
+	return server
+}
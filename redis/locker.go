@@ -0,0 +1,238 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultLockRetryInterval = 100 * time.Millisecond
+	lockKeyPrefix            = "goio.lock:"
+	lockFenceKeyPrefix       = "goio.lock.fence:"
+)
+
+var (
+	// The lock and fence keys of a name share a hash tag, so that they are in
+	// the same slot in cluster mode.
+	acquireLockScript = NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+	renewLockScript = NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+	releaseLockScript = NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+	// ErrLockNotHeld is returned by Unlock when the lease of the lock expired,
+	// so it may have been acquired by someone else in the meantime.
+	ErrLockNotHeld = errors.New("Lock is not held")
+)
+
+// Locker provides distributed locks, which are held for a lease that is renewed
+// automatically until unlocked.
+type Locker interface {
+	// Lock blocks until the lock with the given name is acquired or ctx is done.
+	// The lease of the lock lasts ttl, and is renewed every third of it.
+	Lock(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+	// TryLock acquires the lock with the given name if it is free, returning
+	// false otherwise.
+	TryLock(name string, ttl time.Duration) (Lock, bool, error)
+}
+
+type Lock interface {
+	// Token is a fencing token, which increases every time the lock with the
+	// same name is acquired. Passing it along to the resources protected by the
+	// lock allows them to reject writes from holders whose lease was lost, e.g.
+	// because of a long GC pause.
+	Token() int64
+	// Lost is closed when the lease could not be renewed, after which the lock
+	// must be considered released.
+	Lost() <-chan struct{}
+	// Unlock releases the lock, returning ErrLockNotHeld if it was lost.
+	Unlock() error
+}
+
+type LockerOptions struct {
+	// RetryInterval is how often Lock tries to acquire a busy lock. Defaults to
+	// 100ms.
+	RetryInterval time.Duration
+}
+
+// NewLocker creates a locker using the given Redis. The fencing token of each
+// name is kept in a key that never expires.
+func NewLocker(client Scripter, opts LockerOptions) Locker {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultLockRetryInterval
+	}
+	return &locker{client: client, opts: opts}
+}
+
+type locker struct {
+	client Scripter
+	opts   LockerOptions
+}
+
+func (l *locker) Lock(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	ticker := time.NewTicker(l.opts.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, acquired, err := l.TryLock(name, ttl)
+		if err != nil || acquired {
+			return lock, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "Failed to acquire lock %s", name)
+		}
+	}
+}
+
+func (l *locker) TryLock(name string, ttl time.Duration) (Lock, bool, error) {
+	if ttl < time.Millisecond {
+		return nil, false, errors.Errorf("Lock TTL must be at least 1ms, got %s", ttl)
+	}
+
+	owner, err := newLockOwner()
+	if err != nil {
+		return nil, false, err
+	}
+	lock := &lock{
+		client: l.client,
+		keys:   lockKeys(name),
+		name:   name,
+		owner:  owner,
+		ttl:    ttl,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+
+	// The lease is counted from before the request, as the server may start it
+	// at any time until the reply.
+	acquired := time.Now()
+	token, err := evalInt64(l.client, acquireLockScript, lock.keys, owner, ttl.Milliseconds())
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Failed to acquire lock %s", name)
+	} else if token == 0 {
+		return nil, false, nil
+	}
+
+	lock.token = token
+	lock.wg.Add(1)
+	go lock.renewLoop(acquired)
+	return lock, true, nil
+}
+
+type lock struct {
+	client Scripter
+	keys   []string
+	name   string
+	owner  string
+	ttl    time.Duration
+	token  int64
+
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func (l *lock) Token() int64 {
+	return l.token
+}
+
+func (l *lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *lock) Unlock() error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	l.wg.Wait()
+
+	released, err := evalInt64(l.client, releaseLockScript, l.keys[:1], l.owner)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to release lock %s", l.name)
+	} else if released == 0 {
+		return errors.Wrapf(ErrLockNotHeld, "Failed to release lock %s", l.name)
+	}
+	return nil
+}
+
+// renewLoop renews the lease, which was last started at renewed, until the lock
+// is unlocked or lost.
+func (l *lock) renewLoop(renewed time.Time) {
+	defer l.wg.Done()
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		attempted := time.Now()
+		extended, err := evalInt64(l.client, renewLockScript, l.keys[:1], l.owner, l.ttl.Milliseconds())
+		if err == nil && extended == 1 {
+			renewed = attempted
+			continue
+		}
+
+		// Errors are retried while the lease lasts, but a failed renewal means
+		// the lease already expired. The lock is given up as soon as the lease
+		// may expire before the next attempt, so that holders stop in time.
+		if err != nil {
+			logError(err, "redis_lock_renew_error", "", l.name, "Error renewing lock lease")
+		}
+		if err == nil || time.Since(renewed)+interval >= l.ttl {
+			close(l.lost)
+			return
+		}
+	}
+}
+
+func lockKeys(name string) []string {
+	tag := "{" + name + "}"
+	return []string{lockKeyPrefix + tag, lockFenceKeyPrefix + tag}
+}
+
+// newLockOwner returns a random value identifying an acquisition of a lock, so
+// that only it can renew or release the lock.
+func newLockOwner() (string, error) {
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return "", errors.Wrap(err, "Failed to generate lock owner")
+	}
+	return hex.EncodeToString(owner), nil
+}
+
+func evalInt64(client Scripter, script *Script, keys []string, args ...interface{}) (int64, error) {
+	reply, err := client.Eval(script, keys, args...)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, errors.Errorf("Unexpected script reply: %v", reply)
+	}
+	return value, nil
+}
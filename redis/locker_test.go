@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocker(t *testing.T) {
+	Convey("Locker", t, func() {
+		server := newFakeServer(t)
+		client := New(RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test"}).(Scripter)
+		locker := NewLocker(client, LockerOptions{RetryInterval: 10 * time.Millisecond})
+
+		name := "resource"
+		ttl := 300 * time.Millisecond
+
+		Convey("It should acquire free locks with increasing tokens", func() {
+			lock, acquired, err := locker.TryLock(name, ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+			So(lock.Token(), ShouldEqual, 1)
+			So(lock.Unlock(), ShouldBeNil)
+
+			lock, err = locker.Lock(context.Background(), name, ttl)
+			So(err, ShouldBeNil)
+			So(lock.Token(), ShouldEqual, 2)
+			So(lock.Unlock(), ShouldBeNil)
+		})
+
+		Convey("It should not acquire held locks", func() {
+			lock, _, err := locker.TryLock(name, ttl)
+			So(err, ShouldBeNil)
+			defer lock.Unlock()
+
+			_, acquired, err := locker.TryLock(name, ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeFalse)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err = locker.Lock(ctx, name, ttl)
+			So(errors.Cause(err) == context.DeadlineExceeded, ShouldBeTrue)
+		})
+
+		Convey("It should keep locks held past their TTL", func() {
+			lock, _, err := locker.TryLock(name, ttl)
+			So(err, ShouldBeNil)
+
+			time.Sleep(2 * ttl)
+			select {
+			case <-lock.Lost():
+				t.Error("Lock lost while renewing")
+			default:
+			}
+			So(lock.Unlock(), ShouldBeNil)
+		})
+
+		Convey("It should be lost when the lease expires", func() {
+			lock, _, err := locker.TryLock(name, ttl)
+			So(err, ShouldBeNil)
+
+			server.Advance(ttl)
+			select {
+			case <-lock.Lost():
+			case <-time.After(ttl):
+				t.Error("Lock not lost")
+			}
+			So(errors.Cause(lock.Unlock()), ShouldEqual, ErrLockNotHeld)
+		})
+
+		Convey("It should be lost before the lease expires when renewals fail", func() {
+			start := time.Now()
+			lock, _, err := locker.TryLock(name, ttl)
+			So(err, ShouldBeNil)
+
+			server.Fail("ERR unavailable", "EVALSHA", "EVAL")
+			select {
+			case <-lock.Lost():
+				So(time.Since(start), ShouldBeLessThan, ttl)
+			case <-time.After(2 * ttl):
+				t.Error("Lock not lost")
+			}
+			So(lock.Unlock(), ShouldNotBeNil)
+		})
+	})
+}
@@ -1,38 +1,104 @@
 package redis
 
 import (
+	"context"
+	"crypto/tls"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	redisCluster "github.com/redis/go-redis/v9"
 )
 
 const (
-	dialTimeout       = 1 * time.Second
-	writeTimeout      = 200 * time.Millisecond
-	readTimeout       = 200 * time.Millisecond
-	idlePingThreshold = 30 * time.Second
-	idleConnTimeout   = 3 * time.Minute
+	defaultDialTimeout       = 1 * time.Second
+	defaultWriteTimeout      = 200 * time.Millisecond
+	defaultReadTimeout       = 200 * time.Millisecond
+	defaultIdlePingThreshold = 30 * time.Second
+	defaultIdleConnTimeout   = 3 * time.Minute
 )
 
 type poolOptions struct {
 	MaxIdle, MaxActive int
 	SetReadTimeout     bool
+	Timeouts           connTimeouts
+	Auth               connAuth
+	TLSConfig          *tls.Config
+	// Sentinel makes the pool connect to the master it resolves, ignoring the
+	// endpoint.
+	Sentinel *sentinelResolver
+	// Cluster makes the pool fall back to the other masters of the cluster when
+	// the endpoint is unreachable, for commands that any node can serve.
+	Cluster *redisCluster.ClusterClient
 }
 
-func newRedisPool(endpoint string, opts poolOptions) *redis.Pool {
+type connTimeouts struct {
+	Dial, Read, Write time.Duration
+	IdlePing, Idle    time.Duration
+}
+
+// timeouts returns the connection timeouts in conf, which must have its
+// defaults applied.
+func (conf RedisConfig) timeouts() connTimeouts {
+	return connTimeouts{
+		Dial:     conf.DialTimeout,
+		Read:     conf.ReadTimeout,
+		Write:    conf.WriteTimeout,
+		IdlePing: conf.IdlePingThreshold,
+		Idle:     conf.IdleTimeout,
+	}
+}
+
+type connAuth struct {
+	Username, Password string
+	DB                 int
+}
+
+// auth returns the credentials and database in conf. The database is left out
+// in cluster mode, where only database 0 exists.
+func (conf RedisConfig) auth() connAuth {
+	auth := connAuth{Username: conf.Username, Password: conf.Password}
+	if !conf.ClusterMode {
+		auth.DB = conf.DB
+	}
+	return auth
+}
+
+// dialOptions returns the options with which connections are dialed, both to
+// the data nodes and to the sentinels.
+func dialOptions(timeouts connTimeouts, setReadTimeout bool, tlsConfig *tls.Config) []redis.DialOption {
 	dialOpts := []redis.DialOption{
-		redis.DialConnectTimeout(dialTimeout),
-		redis.DialWriteTimeout(writeTimeout),
+		redis.DialConnectTimeout(timeouts.Dial),
+		redis.DialWriteTimeout(timeouts.Write),
+	}
+	if setReadTimeout {
+		dialOpts = append(dialOpts, redis.DialReadTimeout(timeouts.Read))
 	}
-	if opts.SetReadTimeout {
-		dialOpts = append(dialOpts, redis.DialReadTimeout(readTimeout))
+	if tlsConfig != nil {
+		dialOpts = append(dialOpts, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
 	}
+	return dialOpts
+}
+
+func newRedisPool(endpoint string, opts poolOptions) *redis.Pool {
+	dialOpts := dialOptions(opts.Timeouts, opts.SetReadTimeout, opts.TLSConfig)
 	return &redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return redis.Dial("tcp", endpoint, dialOpts...)
+			if opts.Sentinel != nil {
+				return opts.Sentinel.dialMaster(dialOpts, opts.Auth)
+			}
+
+			conn, err := dial(endpoint, dialOpts, opts.Auth)
+			if err != nil && opts.Cluster != nil {
+				return dialClusterMaster(opts.Cluster, endpoint, dialOpts, opts.Auth)
+			}
+			return conn, err
 		},
 		TestOnBorrow: func(conn redis.Conn, idleSince time.Time) error {
-			if time.Since(idleSince) < idlePingThreshold {
+			if sc, ok := conn.(*sentinelConn); ok && sc.master != opts.Sentinel.Master() {
+				return errors.Errorf("Redis master changed from %s", sc.master)
+			}
+			if time.Since(idleSince) < opts.Timeouts.IdlePing {
 				return nil
 			}
 			_, err := conn.Do("PING")
@@ -41,6 +107,68 @@ func newRedisPool(endpoint string, opts poolOptions) *redis.Pool {
 		MaxIdle:     opts.MaxIdle,
 		MaxActive:   opts.MaxActive,
 		Wait:        true,
-		IdleTimeout: idleConnTimeout,
+		IdleTimeout: opts.Timeouts.Idle,
+	}
+}
+
+func dial(endpoint string, dialOpts []redis.DialOption, auth connAuth) (redis.Conn, error) {
+	conn, err := redis.Dial("tcp", endpoint, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.authenticate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialClusterMaster connects to the first reachable master of the cluster,
+// other than the given endpoint.
+func dialClusterMaster(cluster *redisCluster.ClusterClient, endpoint string, dialOpts []redis.DialOption, auth connAuth) (redis.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+
+	slots, err := cluster.ClusterSlots(ctx).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list Redis cluster nodes")
+	}
+
+	err = errors.Errorf("No Redis cluster master reachable besides %s", endpoint)
+	tried := map[string]bool{endpoint: true}
+	for _, slot := range slots {
+		if len(slot.Nodes) == 0 || tried[slot.Nodes[0].Addr] {
+			continue
+		}
+		addr := slot.Nodes[0].Addr
+		tried[addr] = true
+
+		var conn redis.Conn
+		if conn, err = dial(addr, dialOpts, auth); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// authenticate sends the AUTH and SELECT commands to new connections. It is
+// done here instead of with the redigo dial options since they don't support
+// Redis 6 ACL users.
+func (a connAuth) authenticate(conn redis.Conn) error {
+	if a.Password != "" {
+		args := []interface{}{a.Password}
+		if a.Username != "" {
+			args = []interface{}{a.Username, a.Password}
+		}
+		if _, err := conn.Do("AUTH", args...); err != nil {
+			return errors.Wrap(err, "Failed to authenticate Redis connection")
+		}
+	}
+
+	if a.DB != 0 {
+		if _, err := conn.Do("SELECT", a.DB); err != nil {
+			return errors.Wrapf(err, "Failed to select Redis database %d", a.DB)
+		}
 	}
+	return nil
 }
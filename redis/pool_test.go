@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnAuth(t *testing.T) {
+	Convey("Connections", t, func() {
+		server := newFakeServer(t)
+		conf := RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test"}
+
+		get := func(conf RedisConfig) error {
+			client := New(conf).(*redisC)
+			defer client.Close()
+			var value string
+			_, err := client.Get("key", &value)
+			return err
+		}
+
+		Convey("It should authenticate as the user and select the database before any command", func() {
+			conf.Username = "user"
+			conf.Password = "secret"
+			conf.DB = 3
+			So(get(conf), ShouldBeNil)
+			So(server.Commands(), ShouldResemble, [][]string{
+				{"AUTH", "user", "secret"},
+				{"SELECT", "3"},
+				{"GET", "test:key"},
+			})
+		})
+
+		Convey("It should authenticate with the password only without a username", func() {
+			conf.Password = "secret"
+			So(get(conf), ShouldBeNil)
+			So(server.Commands(), ShouldResemble, [][]string{
+				{"AUTH", "secret"},
+				{"GET", "test:key"},
+			})
+		})
+
+		Convey("It should send neither without credentials and database", func() {
+			So(get(conf), ShouldBeNil)
+			So(server.Commands(), ShouldResemble, [][]string{{"GET", "test:key"}})
+		})
+
+		Convey("It should fail commands when authentication fails", func() {
+			server.Fail("WRONGPASS invalid username-password pair", "AUTH")
+			conf.Password = "wrong"
+			conf.DB = 3
+			So(get(conf), ShouldNotBeNil)
+			So(server.Calls("SELECT"), ShouldEqual, 0)
+			So(server.Calls("GET"), ShouldEqual, 0)
+		})
+
+		Convey("It should not select a database in cluster mode", func() {
+			conf.ClusterMode = true
+			conf.DB = 3
+			So(get(conf), ShouldBeNil)
+			So(server.Calls("SELECT"), ShouldEqual, 0)
+		})
+	})
+}
@@ -16,23 +16,44 @@ type PubSub interface {
 	Cache
 	PSubscribe(patterns []string) (SubChan, error)
 	PUnsubscribe(sub SubChan) error
+	// Subscribe subscribes to exact channels, which is cheaper for Redis than
+	// matching patterns against every published message.
+	Subscribe(channels []string) (SubChan, error)
+	Unsubscribe(sub SubChan) error
 	Publish(key string, data []byte) error
+
+	// SSubscribe subscribes to sharded channels, which in cluster mode are only
+	// propagated within the shard owning the channel's slot, instead of to the
+	// whole cluster (requires Redis 7). Only available in cluster mode.
+	SSubscribe(channels []string) (SubChan, error)
+	SUnsubscribe(sub SubChan) error
+	SPublish(key string, data []byte) error
 }
 
 func NewPubSub(conf RedisConfig) (PubSub, error) {
-	subConn, err := newSubConn(conf.Endpoint)
+	conf = conf.withDefaults()
+	redisC := New(conf).(*redisC)
+	subConn, err := newSubConn(conf, redisC.sentinel, redisC.cluster)
 	if err != nil {
+		redisC.Close()
 		return nil, err
 	}
 
 	pubsub := &redisPubSub{
-		redisC:           New(conf).(*redisC),
+		redisC:           redisC,
 		subscriptionConn: subConn,
 		clientsByChan:    map[SubChan]*pubsubClient{},
-		clientsByPattern: map[string][]*pubsubClient{},
+		clientsByTarget:  map[subTarget][]*pubsubClient{},
 	}
+	pubsub.loops.Add(1)
 	go pubsub.mainLoop()
 
+	if redisC.cluster != nil {
+		pubsub.shardedConn = newShardedSubConn(redisC.cluster)
+		pubsub.loops.Add(1)
+		go pubsub.shardedLoop()
+	}
+
 	return pubsub, nil
 }
 
@@ -40,14 +61,35 @@ type redisPubSub struct {
 	*redisC
 
 	subscriptionConn *subConn
+	// shardedConn holds the sharded subscriptions in cluster mode, and is nil
+	// otherwise.
+	shardedConn *shardedSubConn
+	// loops tracks mainLoop and shardedLoop, which stop once the connections
+	// are closed.
+	loops sync.WaitGroup
 
 	// Both maps hold the same subscriptions, the only difference is that in
-	// subsByPattern they are indexed by subscription pattern so that receiving
-	// from a Redis channel and forwarding to applicable subscriptions doesn't
-	// need iterating through all subscriptions.
-	clientsLock      sync.RWMutex
-	clientsByChan    map[SubChan]*pubsubClient
-	clientsByPattern map[string][]*pubsubClient
+	// clientsByTarget they are indexed by subscription pattern or channel so
+	// that receiving from a Redis channel and forwarding to applicable
+	// subscriptions doesn't need iterating through all subscriptions.
+	clientsLock     sync.RWMutex
+	clientsByChan   map[SubChan]*pubsubClient
+	clientsByTarget map[subTarget][]*pubsubClient
+}
+
+type subKind int
+
+const (
+	patternSub subKind = iota
+	channelSub
+	shardedSub
+)
+
+// subTarget is what a subscription receives messages from, since patterns and
+// channels share the same registry.
+type subTarget struct {
+	kind subKind
+	name string
 }
 
 func (r *redisPubSub) PSubscribe(patterns []string) (SubChan, error) {
@@ -56,10 +98,10 @@ func (r *redisPubSub) PSubscribe(patterns []string) (SubChan, error) {
 		return nil, err
 	}
 
-	recvCh, newPatterns := r.startSub(patterns)
+	recvCh, newPatterns := r.startSub(patternSub, patterns)
 	if len(newPatterns) > 0 {
 		if err := r.subscriptionConn.PSubscribe(newPatterns); err != nil {
-			r.deactivate(recvCh)
+			r.deactivate(patternSub, recvCh)
 			return nil, errors.WithStack(err)
 		}
 	}
@@ -67,7 +109,7 @@ func (r *redisPubSub) PSubscribe(patterns []string) (SubChan, error) {
 }
 
 func (r *redisPubSub) PUnsubscribe(recvCh SubChan) error {
-	unusedPatterns, err := r.deactivate(recvCh)
+	unusedPatterns, err := r.deactivate(patternSub, recvCh)
 	if err != nil {
 		return err
 	}
@@ -80,6 +122,36 @@ func (r *redisPubSub) PUnsubscribe(recvCh SubChan) error {
 	return nil
 }
 
+func (r *redisPubSub) Subscribe(channels []string) (SubChan, error) {
+	channels, err := r.remoteKeys(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	recvCh, newChannels := r.startSub(channelSub, channels)
+	if len(newChannels) > 0 {
+		if err := r.subscriptionConn.Subscribe(newChannels); err != nil {
+			r.deactivate(channelSub, recvCh)
+			return nil, errors.WithStack(err)
+		}
+	}
+	return recvCh, nil
+}
+
+func (r *redisPubSub) Unsubscribe(recvCh SubChan) error {
+	unusedChannels, err := r.deactivate(channelSub, recvCh)
+	if err != nil {
+		return err
+	}
+
+	if len(unusedChannels) > 0 {
+		if err := r.subscriptionConn.Unsubscribe(unusedChannels); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 func (r *redisPubSub) Publish(key string, data []byte) error {
 	key, err := r.remoteKey(key)
 	if err != nil {
@@ -92,19 +164,105 @@ func (r *redisPubSub) Publish(key string, data []byte) error {
 	return nil
 }
 
+func (r *redisPubSub) SSubscribe(channels []string) (SubChan, error) {
+	if r.shardedConn == nil {
+		return nil, errors.New("Sharded pub/sub is only supported in cluster mode")
+	}
+	channels, err := r.remoteKeys(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	recvCh, newChannels := r.startSub(shardedSub, channels)
+	if len(newChannels) > 0 {
+		if err := r.shardedConn.SSubscribe(newChannels); err != nil {
+			r.deactivate(shardedSub, recvCh)
+			return nil, errors.WithStack(err)
+		}
+	}
+	return recvCh, nil
+}
+
+func (r *redisPubSub) SUnsubscribe(recvCh SubChan) error {
+	if r.shardedConn == nil {
+		return errors.New("Sharded pub/sub is only supported in cluster mode")
+	}
+	unusedChannels, err := r.deactivate(shardedSub, recvCh)
+	if err != nil {
+		return err
+	}
+
+	if len(unusedChannels) > 0 {
+		if err := r.shardedConn.SUnsubscribe(unusedChannels); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (r *redisPubSub) SPublish(key string, data []byte) error {
+	if r.shardedConn == nil {
+		return errors.New("Sharded pub/sub is only supported in cluster mode")
+	}
+	key, err := r.remoteKey(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.doCmd("SPUBLISH", key, string(data)); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close closes the subscription connections, and then the channels of the
+// remaining subscriptions and the client, once no more messages are delivered.
+func (r *redisPubSub) Close() error {
+	r.subscriptionConn.Close()
+	if r.shardedConn != nil {
+		r.shardedConn.Close()
+	}
+	r.loops.Wait()
+
+	r.clientsLock.Lock()
+	for recvCh, cl := range r.clientsByChan {
+		if !cl.isClosed() {
+			cl.Close()
+		}
+		delete(r.clientsByChan, recvCh)
+	}
+	r.clientsByTarget = map[subTarget][]*pubsubClient{}
+	r.clientsLock.Unlock()
+
+	return r.redisC.Close()
+}
+
 func (r *redisPubSub) mainLoop() {
+	defer r.loops.Done()
 	for msg := range r.subscriptionConn.ReceiveChan() {
-		r.send(msg.Pattern, msg.Data)
+		// Only messages from pattern subscriptions have a pattern.
+		if msg.Pattern != "" {
+			r.send(subTarget{patternSub, msg.Pattern}, msg.Data)
+		} else {
+			r.send(subTarget{channelSub, msg.Channel}, msg.Data)
+		}
+	}
+}
+
+func (r *redisPubSub) shardedLoop() {
+	defer r.loops.Done()
+	for msg := range r.shardedConn.ReceiveChan() {
+		r.send(subTarget{shardedSub, msg.Channel}, []byte(msg.Payload))
 	}
 }
 
-func (r *redisPubSub) send(pattern string, data []byte) {
+func (r *redisPubSub) send(target subTarget, data []byte) {
 	defer func() {
 		if r := recover(); r != nil {
 			logrus.
 				WithField("code", "pubsub_error").
 				WithField("panic", r).
-				WithField("pattern", pattern).
+				WithField("pattern", target.name).
 				WithField("data", string(data)).
 				Error("Error executing redis pub/sub callback")
 		}
@@ -113,35 +271,41 @@ func (r *redisPubSub) send(pattern string, data []byte) {
 	r.clientsLock.RLock()
 	defer r.clientsLock.RUnlock()
 
-	for _, cl := range r.clientsByPattern[pattern] {
+	for _, cl := range r.clientsByTarget[target] {
 		cl.Send(data)
 	}
 }
 
-func (r *redisPubSub) startSub(patterns []string) (SubChan, []interface{}) {
+// startSub registers a subscription, returning the patterns or channels that
+// had no subscriptions yet, so that the caller subscribes to them in Redis.
+func (r *redisPubSub) startSub(kind subKind, names []string) (SubChan, []interface{}) {
 	r.clientsLock.Lock()
 	defer r.clientsLock.Unlock()
 
-	cl, recvCh := newPubSubClient(patterns)
+	cl, recvCh := newPubSubClient(kind, names)
 	r.clientsByChan[recvCh] = cl
 
-	newPatterns := []interface{}{}
-	for _, p := range patterns {
-		patternClients := r.clientsByPattern[p]
-		if len(patternClients) == 0 {
-			newPatterns = append(newPatterns, p)
+	newNames := []interface{}{}
+	for _, name := range names {
+		target := subTarget{kind, name}
+		targetClients := r.clientsByTarget[target]
+		if len(targetClients) == 0 {
+			newNames = append(newNames, name)
 		}
-		patternClients = append(patternClients, cl)
+		targetClients = append(targetClients, cl)
 
-		r.clientsByPattern[p] = patternClients
+		r.clientsByTarget[target] = targetClients
 	}
 
-	return recvCh, newPatterns
+	return recvCh, newNames
 }
 
-func (r *redisPubSub) deactivate(recvCh SubChan) ([]interface{}, error) {
+// deactivate unregisters a subscription of the given kind, returning the
+// patterns or channels left without subscriptions, so that the caller
+// unsubscribes from them in Redis.
+func (r *redisPubSub) deactivate(kind subKind, recvCh SubChan) ([]interface{}, error) {
 	cl := r.clientByChan(recvCh)
-	if cl == nil {
+	if cl == nil || cl.kind != kind {
 		return nil, errors.Errorf("Attempt to deactive unknown subscription: %v", recvCh)
 	}
 	cl.Close()
@@ -151,20 +315,21 @@ func (r *redisPubSub) deactivate(recvCh SubChan) ([]interface{}, error) {
 
 	delete(r.clientsByChan, recvCh)
 
-	unusedPatterns := []interface{}{}
-	for _, p := range cl.patterns {
-		patternClients := r.clientsByPattern[p]
+	unusedNames := []interface{}{}
+	for _, name := range cl.patterns {
+		target := subTarget{kind, name}
+		targetClients := r.clientsByTarget[target]
 
-		patternClients = removeClient(patternClients, cl)
-		if len(patternClients) > 0 {
-			r.clientsByPattern[p] = patternClients
+		targetClients = removeClient(targetClients, cl)
+		if len(targetClients) > 0 {
+			r.clientsByTarget[target] = targetClients
 		} else {
-			delete(r.clientsByPattern, p)
-			unusedPatterns = append(unusedPatterns, p)
+			delete(r.clientsByTarget, target)
+			unusedNames = append(unusedNames, name)
 		}
 	}
 
-	return unusedPatterns, nil
+	return unusedNames, nil
 }
 
 func removeClient(clients []*pubsubClient, cl *pubsubClient) []*pubsubClient {
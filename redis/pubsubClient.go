@@ -8,15 +8,18 @@ import (
 )
 
 type pubsubClient struct {
-	mu       sync.RWMutex
+	mu   sync.RWMutex
+	kind subKind
+	// patterns holds the patterns or channels subscribed, depending on kind.
 	patterns []string
 	sendCh   chan<- []byte
 	done     chan struct{}
 }
 
-func newPubSubClient(patterns []string) (*pubsubClient, <-chan []byte) {
+func newPubSubClient(kind subKind, patterns []string) (*pubsubClient, <-chan []byte) {
 	subChan := make(chan []byte, 10)
 	sub := &pubsubClient{
+		kind:     kind,
 		patterns: patterns,
 		sendCh:   subChan,
 		done:     make(chan struct{}),
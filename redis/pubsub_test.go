@@ -0,0 +1,198 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPubSub(t *testing.T) {
+	for _, clusterMode := range []bool{false, true} {
+		Convey("PubSub", t, func() {
+			server := newFakeServer(t)
+			conf := RedisConfig{
+				Endpoint:     server.Addr(),
+				KeyNamespace: "test",
+				ClusterMode:  clusterMode,
+			}
+
+			Convey("It should deliver published messages until closed", func() {
+				subject, err := NewPubSub(conf)
+				So(err, ShouldBeNil)
+
+				ch, err := subject.Subscribe([]string{"channel"})
+				So(err, ShouldBeNil)
+				waitSubscribed(server, "SUBSCRIBE", 2)
+				So(subject.Publish("channel", []byte("hello")), ShouldBeNil)
+				So(string(receiveSub(t, ch)), ShouldEqual, "hello")
+
+				So(subject.(*redisPubSub).Close(), ShouldBeNil)
+				_, open := <-ch
+				So(open, ShouldBeFalse)
+				So(waitConns(server, 0), ShouldBeTrue)
+
+				_, err = subject.Subscribe([]string{"other"})
+				So(err, ShouldNotBeNil)
+				So(subject.(*redisPubSub).Close(), ShouldBeNil)
+			})
+
+			Convey("It should restore the subscriptions when the connection drops", func() {
+				subject, err := NewPubSub(conf)
+				So(err, ShouldBeNil)
+				defer subject.(*redisPubSub).Close()
+
+				channelCh, err := subject.Subscribe([]string{"channel"})
+				So(err, ShouldBeNil)
+				patternCh, err := subject.PSubscribe([]string{"pattern:*"})
+				So(err, ShouldBeNil)
+				waitSubscribed(server, "SUBSCRIBE", 2)
+				waitSubscribed(server, "PSUBSCRIBE", 1)
+
+				// The patterns are restored before the channels, after the dummy
+				// channel.
+				server.DropConns()
+				waitSubscribed(server, "SUBSCRIBE", 4)
+				So(server.Calls("PSUBSCRIBE"), ShouldEqual, 2)
+				So(server.LastArgs("PSUBSCRIBE"), ShouldResemble, []string{"test:pattern:*"})
+				So(server.LastArgs("SUBSCRIBE"), ShouldResemble, []string{"test:channel"})
+
+				// The idle connections of the subject were dropped as well.
+				publisher, err := NewPubSub(conf)
+				So(err, ShouldBeNil)
+				defer publisher.(*redisPubSub).Close()
+				So(publisher.Publish("channel", []byte("hello")), ShouldBeNil)
+				So(string(receiveSub(t, channelCh)), ShouldEqual, "hello")
+				So(publisher.Publish("pattern:a", []byte("world")), ShouldBeNil)
+				So(string(receiveSub(t, patternCh)), ShouldEqual, "world")
+			})
+
+			if clusterMode {
+				Convey("It should close the sharded subscriptions", func() {
+					subject, err := NewPubSub(conf)
+					So(err, ShouldBeNil)
+
+					ch, err := subject.SSubscribe([]string{"channel"})
+					So(err, ShouldBeNil)
+					waitSubscribed(server, "SSUBSCRIBE", 1)
+					So(subject.SPublish("channel", []byte("hello")), ShouldBeNil)
+					So(string(receiveSub(t, ch)), ShouldEqual, "hello")
+
+					So(subject.(*redisPubSub).Close(), ShouldBeNil)
+					_, open := <-ch
+					So(open, ShouldBeFalse)
+					So(waitConns(server, 0), ShouldBeTrue)
+				})
+
+				Convey("It should resubscribe sharded channels when the connection drops", func() {
+					subject, err := NewPubSub(conf)
+					So(err, ShouldBeNil)
+					defer subject.(*redisPubSub).Close()
+
+					ch, err := subject.SSubscribe([]string{"channel"})
+					So(err, ShouldBeNil)
+					waitSubscribed(server, "SSUBSCRIBE", 1)
+
+					// The client reconnects by itself first, and then the connection
+					// is replaced by one routed by the channel.
+					server.DropConns()
+					waitSubscribed(server, "SSUBSCRIBE", 3)
+					So(subject.SPublish("channel", []byte("hello")), ShouldBeNil)
+					So(string(receiveSub(t, ch)), ShouldEqual, "hello")
+				})
+
+				Convey("It should resubscribe sharded channels when their slot moves", func() {
+					subject, err := NewPubSub(conf)
+					So(err, ShouldBeNil)
+					defer subject.(*redisPubSub).Close()
+
+					ch, err := subject.SSubscribe([]string{"channel", "other"})
+					So(err, ShouldBeNil)
+					waitSubscribed(server, "SSUBSCRIBE", 2)
+
+					server.MoveSlot("test:channel")
+					waitSubscribed(server, "SSUBSCRIBE", 3)
+					So(server.LastArgs("SSUBSCRIBE"), ShouldResemble, []string{"test:channel"})
+					So(subject.SPublish("channel", []byte("hello")), ShouldBeNil)
+					So(string(receiveSub(t, ch)), ShouldEqual, "hello")
+				})
+			} else {
+				Convey("It should only support sharded pub/sub in cluster mode", func() {
+					subject, err := NewPubSub(conf)
+					So(err, ShouldBeNil)
+					defer subject.(*redisPubSub).Close()
+
+					_, err = subject.SSubscribe([]string{"channel"})
+					So(err, ShouldNotBeNil)
+					So(subject.SUnsubscribe(make(SubChan)), ShouldNotBeNil)
+					So(subject.SPublish("channel", []byte("hello")), ShouldNotBeNil)
+					So(server.Calls("SPUBLISH"), ShouldEqual, 0)
+				})
+			}
+
+			Convey("It should release the client when failing to subscribe", func() {
+				server.Fail("ERR subscribe failed", "SUBSCRIBE")
+				_, err := NewPubSub(conf)
+				So(err, ShouldNotBeNil)
+				So(waitConns(server, 0), ShouldBeTrue)
+			})
+		})
+	}
+
+	Convey("PubSub in Sentinel mode", t, func() {
+		master := newFakeServer(t)
+		sentinel := newFakeServer(t)
+		sentinel.SetMaster(master.Addr())
+		conf := RedisConfig{
+			SentinelMasterName: "pubsub",
+			SentinelAddrs:      []string{sentinel.Addr()},
+		}
+
+		Convey("It should release the resolver when failing to subscribe", func() {
+			master.Fail("ERR subscribe failed", "SUBSCRIBE")
+			_, err := NewPubSub(conf)
+			So(err, ShouldNotBeNil)
+
+			sentinelResolversMu.Lock()
+			defer sentinelResolversMu.Unlock()
+			So(sentinelResolvers, ShouldBeEmpty)
+		})
+
+		Convey("It should release the resolver when closed", func() {
+			subject, err := NewPubSub(conf)
+			So(err, ShouldBeNil)
+			resolver := subject.(*redisPubSub).sentinel
+			So(subject.(*redisPubSub).Close(), ShouldBeNil)
+			So(isClosed(resolver.done), ShouldBeTrue)
+			So(resolver.listeners, ShouldBeEmpty)
+		})
+	})
+}
+
+func receiveSub(t *testing.T, ch SubChan) []byte {
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(2 * time.Second):
+		t.Error("No message received")
+		return nil
+	}
+}
+
+// waitSubscribed waits for the subscription command to be received n times,
+// since subscribing doesn't wait for the reply.
+func waitSubscribed(server *fakeServer, cmd string, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Calls(cmd) < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitConns returns whether the server ends up with n open connections.
+func waitConns(server *fakeServer, n int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Conns() != n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return server.Conns() == n
+}
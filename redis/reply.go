@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// The helpers below convert replies like the redigo ones, but also accept the
+// types of replies from the cluster client, which has strings instead of
+// []byte and, with RESP3, maps instead of arrays of alternating keys and values.
+
+func replyBytes(reply interface{}) ([]byte, error) {
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, redis.ErrNil
+	}
+	return nil, errors.Errorf("Unexpected type for Redis bulk string reply: %T", reply)
+}
+
+func replyByteSlices(reply interface{}, err error) ([][]byte, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([][]byte, 0, len(values))
+	for _, value := range values {
+		bytes, err := replyBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, bytes)
+	}
+	return result, nil
+}
+
+func replyBytesMap(reply interface{}, err error) (map[string][]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if m, isMap := reply.(map[interface{}]interface{}); isMap {
+		result := make(map[string][]byte, len(m))
+		for key, value := range m {
+			keyBytes, err := replyBytes(key)
+			if err != nil {
+				return nil, err
+			}
+			if result[string(keyBytes)], err = replyBytes(value); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	pairs, err := replyByteSlices(reply, nil)
+	if err != nil {
+		return nil, err
+	} else if len(pairs)%2 != 0 {
+		return nil, errors.New("Expected even number of values in Redis map reply")
+	}
+	result := make(map[string][]byte, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		result[string(pairs[i])] = pairs[i+1]
+	}
+	return result, nil
+}
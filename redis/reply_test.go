@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplies(t *testing.T) {
+	Convey("Replies", t, func() {
+		Convey("It should convert bulk strings of both clients", func() {
+			data, err := replyBytes([]byte("a"))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "a")
+
+			data, err = replyBytes("a")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "a")
+
+			_, err = replyBytes(nil)
+			So(err, ShouldEqual, redis.ErrNil)
+
+			_, err = replyBytes(int64(1))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should convert arrays of bulk strings", func() {
+			values, err := replyByteSlices([]interface{}{"a", []byte("b")}, nil)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, [][]byte{[]byte("a"), []byte("b")})
+
+			_, err = replyByteSlices([]interface{}{"a", nil}, nil)
+			So(err, ShouldEqual, redis.ErrNil)
+		})
+
+		Convey("It should convert maps of RESP2 and RESP3", func() {
+			expected := map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+
+			values, err := replyBytesMap([]interface{}{"a", "1", []byte("b"), []byte("2")}, nil)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, expected)
+
+			values, err = replyBytesMap(map[interface{}]interface{}{"a": "1", "b": "2"}, nil)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, expected)
+
+			_, err = replyBytesMap([]interface{}{"a"}, nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Script is a Lua script to be run by Redis with Eval. It is sent by its hash,
+// so that its source is only sent the first time each server runs it.
+type Script struct {
+	src  string
+	hash string
+}
+
+// Scripter is a Cache which also runs Lua scripts. It is kept apart from Cache
+// so that implementations of Cache don't need to support scripting. The clients
+// returned by New implement it, e.g. New(conf).(Scripter).
+type Scripter interface {
+	Cache
+	Eval(script *Script, keys []string, args ...interface{}) (interface{}, error)
+}
+
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{src: src, hash: hex.EncodeToString(sum[:])}
+}
+
+// Hash returns the SHA1 of the script source, by which EVALSHA runs it.
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Eval runs the script with the given keys, which are namespaced like all other
+// keys, and arguments. In cluster mode, all keys must belong to the same slot
+// (see https://redis.io/docs/reference/cluster-spec/#hash-tags). Timeouts for
+// scripts can be set in CommandTimeouts for EVALSHA and EVAL.
+func (r *redisC) Eval(script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	cmdArgs := make([]interface{}, 0, 2+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, script.hash, len(keys))
+	for _, key := range keys {
+		key, err := r.remoteKey(key)
+		if err != nil {
+			return nil, err
+		}
+		cmdArgs = append(cmdArgs, key)
+	}
+	cmdArgs = append(cmdArgs, args...)
+
+	reply, err := r.doCmd("EVALSHA", cmdArgs...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		cmdArgs[0] = script.src
+		reply, err = r.doCmd("EVAL", cmdArgs...)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to run script on Redis")
+	}
+	return reply, nil
+}
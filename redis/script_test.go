@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEval(t *testing.T) {
+	Convey("Eval", t, func() {
+		server := newFakeServer(t)
+		client := New(RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test"}).(Scripter)
+		defer client.(*redisC).Close()
+
+		script := NewScript(`return {KEYS[1], ARGV[1]}`)
+		server.AddScript(script.Hash(), func(s *fakeServer, keys, args []string) interface{} {
+			return []interface{}{keys[0], args[0]}
+		})
+
+		Convey("It should send the source only when Redis doesn't have the script", func() {
+			reply, err := client.Eval(script, []string{"key"}, "arg")
+			So(err, ShouldBeNil)
+			So(reply, ShouldResemble, []interface{}{[]byte("test:key"), []byte("arg")})
+			So(server.Calls("EVALSHA"), ShouldEqual, 1)
+			So(server.Calls("EVAL"), ShouldEqual, 1)
+			So(server.LastArgs("EVAL")[0], ShouldEqual, `return {KEYS[1], ARGV[1]}`)
+
+			_, err = client.Eval(script, []string{"key"}, "arg")
+			So(err, ShouldBeNil)
+			So(server.Calls("EVALSHA"), ShouldEqual, 2)
+			So(server.Calls("EVAL"), ShouldEqual, 1)
+			So(server.LastArgs("EVALSHA")[0], ShouldEqual, script.Hash())
+		})
+
+		Convey("It should send the source again once Redis loses the script", func() {
+			_, err := client.Eval(script, []string{"key"}, "arg")
+			So(err, ShouldBeNil)
+
+			server.FlushScripts()
+			reply, err := client.Eval(script, []string{"key"}, "arg")
+			So(err, ShouldBeNil)
+			So(reply, ShouldResemble, []interface{}{[]byte("test:key"), []byte("arg")})
+			So(server.Calls("EVAL"), ShouldEqual, 2)
+		})
+
+		Convey("It should return script errors", func() {
+			server.Fail("ERR Error running script", "EVALSHA")
+			_, err := client.Eval(script, []string{"key"}, "arg")
+			So(err, ShouldNotBeNil)
+			So(server.Calls("EVAL"), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,327 @@
+package redis
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	switchMasterChannel   = "+switch-master"
+	sentinelRetryDelay    = 1 * time.Second
+	sentinelWatchInterval = 30 * time.Second
+)
+
+// sentinelResolver keeps track of the address of the master of a Redis Sentinel
+// deployment, both by asking the sentinels when resolving it and by watching the
+// failovers they announce. Resolvers are shared by the clients with the same
+// Sentinel configuration (see acquireSentinelResolver).
+type sentinelResolver struct {
+	config sentinelConfig
+	addrs  []string
+	// refs counts the clients using the resolver, and is guarded by
+	// sentinelResolversMu.
+	refs int
+	done chan struct{}
+
+	mu        sync.RWMutex
+	master    string
+	listeners []chan string
+}
+
+// sentinelConfig is the part of RedisConfig used by resolvers, identifying the
+// ones that can be shared.
+type sentinelConfig struct {
+	masterName string
+	addrs      string
+	auth       connAuth
+	timeouts   connTimeouts
+	tlsConfig  *tls.Config
+}
+
+var (
+	sentinelResolversMu sync.Mutex
+	sentinelResolvers   = map[sentinelConfig]*sentinelResolver{}
+)
+
+// acquireSentinelResolver returns the resolver for the Sentinel configuration in
+// conf, which must have its defaults applied, creating it if no other client is
+// using it. It must be released once the client is closed.
+func acquireSentinelResolver(conf RedisConfig) *sentinelResolver {
+	config := sentinelConfig{
+		masterName: conf.SentinelMasterName,
+		addrs:      strings.Join(conf.SentinelAddrs, ","),
+		auth:       connAuth{Username: conf.Username, Password: conf.SentinelPassword},
+		timeouts:   conf.timeouts(),
+		tlsConfig:  conf.TLSConfig,
+	}
+
+	sentinelResolversMu.Lock()
+	defer sentinelResolversMu.Unlock()
+	if r, ok := sentinelResolvers[config]; ok {
+		r.refs++
+		return r
+	}
+
+	r := &sentinelResolver{
+		config: config,
+		addrs:  conf.SentinelAddrs,
+		refs:   1,
+		done:   make(chan struct{}),
+	}
+	sentinelResolvers[config] = r
+	go r.watch()
+	return r
+}
+
+// release stops watching the sentinels once no client uses the resolver.
+func (r *sentinelResolver) release() {
+	sentinelResolversMu.Lock()
+	defer sentinelResolversMu.Unlock()
+
+	r.refs--
+	if r.refs == 0 {
+		delete(sentinelResolvers, r.config)
+		close(r.done)
+	}
+}
+
+// Master returns the last resolved master address, or an empty string if it
+// was never resolved.
+func (r *sentinelResolver) Master() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.master
+}
+
+// Listen returns a channel which receives the new master address on failovers.
+// Changes may be coalesced if the receiver is not keeping up.
+func (r *sentinelResolver) Listen() <-chan string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	listener := make(chan string, 1)
+	r.listeners = append(r.listeners, listener)
+	return listener
+}
+
+// Unlisten stops sending master changes to a channel returned by Listen.
+func (r *sentinelResolver) Unlisten(listener <-chan string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, l := range r.listeners {
+		if l == listener {
+			r.listeners = append(r.listeners[:i], r.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// Resolve asks the sentinels, in order, for the current master address.
+func (r *sentinelResolver) Resolve() (string, error) {
+	var lastErr error
+	for _, addr := range r.addrs {
+		master, err := r.queryMaster(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r.setMaster(master)
+		return master, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("No sentinel addresses configured")
+	}
+	return "", errors.Wrapf(lastErr, "Failed to resolve Redis master %s", r.config.masterName)
+}
+
+func (r *sentinelResolver) queryMaster(addr string) (string, error) {
+	conn, err := r.dial(addr, true)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", r.config.masterName))
+	if err == redis.ErrNil {
+		return "", errors.Errorf("Sentinel %s does not know master %s", addr, r.config.masterName)
+	} else if err != nil {
+		return "", errors.Wrapf(err, "Failed to query sentinel %s", addr)
+	} else if len(reply) != 2 {
+		return "", errors.Errorf("Unexpected reply from sentinel %s: %v", addr, reply)
+	}
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+func (r *sentinelResolver) setMaster(master string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.master
+	r.master = master
+	if previous == "" || previous == master {
+		return
+	}
+	for _, listener := range r.listeners {
+		select {
+		case listener <- master:
+		default:
+		}
+	}
+}
+
+// watch subscribes to the failovers announced by the sentinels, moving to the
+// next one on errors, until the resolver is released. Each time it subscribes,
+// the master is also resolved, so that failovers are not missed while
+// reconnecting.
+func (r *sentinelResolver) watch() {
+	if len(r.addrs) == 0 {
+		return
+	}
+	for i := 0; ; i = (i + 1) % len(r.addrs) {
+		err := r.watchSentinel(r.addrs[i])
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		if err != nil {
+			logError(err, "redis_sentinel_watch_error", "", "", "Error watching Redis sentinel")
+		}
+
+		select {
+		case <-time.After(sentinelRetryDelay):
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *sentinelResolver) watchSentinel(addr string) error {
+	conn, err := r.dial(addr, false)
+	if err != nil {
+		return err
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err := psc.Subscribe(switchMasterChannel); err != nil {
+		return errors.Wrapf(err, "Failed to subscribe to sentinel %s", addr)
+	}
+	if _, err := r.Resolve(); err != nil {
+		return err
+	}
+
+	// Pings make sure a broken connection is noticed by the receive timeout,
+	// while closing the connection interrupts it once the resolver is released.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(sentinelWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if psc.Ping("") != nil {
+					return
+				}
+			case <-r.done:
+				psc.Close()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		switch msg := psc.ReceiveWithTimeout(2 * sentinelWatchInterval).(type) {
+		case redis.Message:
+			// The message is "<master name> <old ip> <old port> <new ip> <new port>".
+			fields := strings.Fields(string(msg.Data))
+			if len(fields) == 5 && fields[0] == r.config.masterName {
+				r.setMaster(net.JoinHostPort(fields[3], fields[4]))
+			}
+		case error:
+			return errors.Wrapf(msg, "Error receiving from sentinel %s", addr)
+		}
+	}
+}
+
+// dial connects to a sentinel with the same options as to the data nodes,
+// except for the password.
+func (r *sentinelResolver) dial(addr string, setReadTimeout bool) (redis.Conn, error) {
+	dialOpts := dialOptions(r.config.timeouts, setReadTimeout, r.config.tlsConfig)
+	conn, err := dial(addr, dialOpts, r.config.auth)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to sentinel %s", addr)
+	}
+	return conn, nil
+}
+
+// dialMaster connects to the current master, checking its role since sentinels
+// may briefly report a master which was already demoted. The master is kept up
+// to date by watch, so the sentinels are only asked for it when it was never
+// resolved, or after failing to connect to it.
+func (r *sentinelResolver) dialMaster(dialOpts []redis.DialOption, auth connAuth) (redis.Conn, error) {
+	master := r.Master()
+	if master == "" {
+		var err error
+		if master, err = r.Resolve(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := dialCheckingRole(master, dialOpts, auth)
+	if err != nil {
+		// A failover may have been missed, so the master is refreshed for the
+		// next connection.
+		r.Resolve()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func dialCheckingRole(master string, dialOpts []redis.DialOption, auth connAuth) (redis.Conn, error) {
+	conn, err := dial(master, dialOpts, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err == nil && len(role) > 0 {
+		var name string
+		if name, err = redis.String(role[0], nil); err == nil && name != "master" {
+			err = errors.Errorf("Role is %s", name)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "Failed to check role of Redis master %s", master)
+	}
+	return &sentinelConn{Conn: conn, master: master}, nil
+}
+
+// sentinelConn is a connection to a master resolved by sentinels, which must
+// be discarded once the master changes.
+type sentinelConn struct {
+	redis.Conn
+	master string
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func isReadOnlyError(err error) bool {
+	redisErr, ok := errors.Cause(err).(redis.Error)
+	return ok && strings.HasPrefix(string(redisErr), "READONLY")
+}
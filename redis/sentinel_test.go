@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSentinel(t *testing.T) {
+	Convey("Sentinel mode", t, func() {
+		master := newFakeServer(t)
+		sentinel := newFakeServer(t)
+		sentinel.SetMaster(master.Addr())
+
+		conf := RedisConfig{
+			SentinelMasterName: "mymaster",
+			SentinelAddrs:      []string{sentinel.Addr()},
+			SentinelPassword:   "sentinel_secret",
+			Username:           "user",
+			Password:           "secret",
+		}
+		client := New(conf).(*redisC)
+		defer client.Close()
+
+		Convey("It should share the resolver between clients with the same configuration", func() {
+			other := New(conf).(*redisC)
+			So(other.sentinel, ShouldEqual, client.sentinel)
+
+			So(other.Close(), ShouldBeNil)
+			So(other.Close(), ShouldBeNil)
+			So(isClosed(client.sentinel.done), ShouldBeFalse)
+
+			So(client.Close(), ShouldBeNil)
+			So(isClosed(client.sentinel.done), ShouldBeTrue)
+			sentinelResolversMu.Lock()
+			defer sentinelResolversMu.Unlock()
+			So(sentinelResolvers, ShouldNotContainKey, client.sentinel.config)
+		})
+
+		Convey("It should authenticate to the sentinels with the configured user", func() {
+			_, err := client.sentinel.Resolve()
+			So(err, ShouldBeNil)
+			So(sentinel.LastArgs("AUTH"), ShouldResemble, []string{"user", "sentinel_secret"})
+		})
+
+		Convey("It should connect to the master watched by the resolver without asking the sentinels", func() {
+			deadline := time.Now().Add(time.Second)
+			for client.sentinel.Master() == "" && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(client.sentinel.Master(), ShouldEqual, master.Addr())
+
+			queries := sentinel.Calls("SENTINEL")
+			for i := 0; i < 3; i++ {
+				conn, err := client.pool.Dial()
+				So(err, ShouldBeNil)
+				conn.Close()
+			}
+			So(sentinel.Calls("SENTINEL"), ShouldEqual, queries)
+			So(master.Calls("ROLE"), ShouldEqual, 3)
+			So(master.LastArgs("AUTH"), ShouldResemble, []string{"user", "secret"})
+		})
+	})
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,303 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	redisCluster "github.com/redis/go-redis/v9"
+)
+
+const (
+	clusterSlots             = 16384
+	shardedSubErrorRetryWait = 1 * time.Second
+)
+
+// shardedSubConn holds the sharded subscriptions in cluster mode. Channels are
+// grouped by slot, each group with a connection to the master owning the slot,
+// since a single SSUBSCRIBE command can't span slots. Using hash tags to put
+// related channels in the same slot thus saves connections.
+type shardedSubConn struct {
+	cluster    *redisCluster.ClusterClient
+	outputChan chan *redisCluster.Message
+
+	mu     sync.Mutex
+	shards map[int]*shardSub
+	closed bool
+	// loops tracks the receive loops of the shards, so that the receive channel
+	// is only closed once they have stopped.
+	loops sync.WaitGroup
+}
+
+func newShardedSubConn(cluster *redisCluster.ClusterClient) *shardedSubConn {
+	return &shardedSubConn{
+		cluster:    cluster,
+		outputChan: make(chan *redisCluster.Message, channelsBuffersSize),
+		shards:     map[int]*shardSub{},
+	}
+}
+
+func (c *shardedSubConn) SSubscribe(channels []interface{}) error {
+	if len(channels) == 0 {
+		return errors.New("Must send at least one channel to subscribe")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("Sharded subscriptions connection is closed")
+	}
+
+	for slot, slotChannels := range channelsBySlot(channels) {
+		shard, ok := c.shards[slot]
+		if !ok {
+			shard = &shardSub{parent: c, channels: map[string]bool{}, stop: make(chan struct{})}
+		}
+		if err := shard.subscribe(slotChannels); err != nil {
+			if !ok {
+				shard.pubsub.Close()
+			}
+			return err
+		}
+		if !ok {
+			c.shards[slot] = shard
+			c.loops.Add(1)
+			go shard.receiveLoop()
+		}
+	}
+	return nil
+}
+
+func (c *shardedSubConn) SUnsubscribe(channels []interface{}) error {
+	if len(channels) == 0 {
+		return errors.New("Must send at least one channel to unsubscribe")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for slot, slotChannels := range channelsBySlot(channels) {
+		shard, ok := c.shards[slot]
+		if !ok {
+			continue
+		}
+		if shard.unsubscribe(slotChannels) {
+			delete(c.shards, slot)
+		}
+	}
+	return nil
+}
+
+// Close closes the subscriptions of all shards, and then the receive channel
+// once their receive loops have stopped.
+func (c *shardedSubConn) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	for slot, shard := range c.shards {
+		close(shard.stop)
+		shard.pubsub.Close()
+		delete(c.shards, slot)
+	}
+	c.mu.Unlock()
+
+	c.loops.Wait()
+	close(c.outputChan)
+}
+
+func (c *shardedSubConn) ReceiveChan() <-chan *redisCluster.Message {
+	return c.outputChan
+}
+
+// shardSub is the subscription to the channels of a slot. Its fields are
+// guarded by the parent lock.
+type shardSub struct {
+	parent   *shardedSubConn
+	channels map[string]bool
+	pubsub   *redisCluster.PubSub
+	stop     chan struct{}
+}
+
+func (s *shardSub) subscribe(channels []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+
+	if s.pubsub == nil {
+		// Subscribing without channels doesn't connect yet, so that the
+		// connection is routed by the channels subscribed below.
+		s.pubsub = s.parent.cluster.SSubscribe(ctx)
+	}
+	if err := s.pubsub.SSubscribe(ctx, channels...); err != nil {
+		return errors.Wrapf(err, "Error subscribing to sharded channels %s", channels)
+	}
+	for _, channel := range channels {
+		s.channels[channel] = true
+	}
+	return nil
+}
+
+// unsubscribe returns whether no channels are left, in which case the shard
+// subscription is closed.
+func (s *shardSub) unsubscribe(channels []string) bool {
+	for _, channel := range channels {
+		delete(s.channels, channel)
+	}
+	if len(s.channels) == 0 {
+		close(s.stop)
+		s.pubsub.Close()
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+
+	if err := s.pubsub.SUnsubscribe(ctx, channels...); err != nil {
+		// The channels were already removed, so the connection recovery will
+		// leave them out.
+		logError(err, "unsubscribe_error", "", strings.Join(channels, "; "), "Redis SUnsubscribe command error")
+		s.resubscribe()
+	}
+	return false
+}
+
+func (s *shardSub) receiveLoop() {
+	defer s.parent.loops.Done()
+	for {
+		s.parent.mu.Lock()
+		pubsub := s.pubsub
+		s.parent.mu.Unlock()
+
+		msg, err := pubsub.ReceiveTimeout(context.Background(), pingDelay)
+		if s.isStopped() {
+			return
+		}
+
+		switch v := msg.(type) {
+		case *redisCluster.Message:
+			s.parent.outputChan <- v
+			continue
+
+		case *redisCluster.Subscription:
+			if v.Kind == "sunsubscribe" && s.isSubscribed(v.Channel) {
+				// Redis unsubscribes the clients of a slot when it moves to
+				// another shard, as on resharding or failovers.
+				logError(errors.Errorf("Slot of channel %s moved", v.Channel), "sharded_slot_moved", "", v.Channel, "Resubscribing to sharded channels")
+				s.recoverConn(pubsub)
+			}
+			continue
+		}
+
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			if err = pubsub.Ping(context.Background()); err == nil {
+				continue
+			}
+		}
+		if err != nil && !s.isReplaced(pubsub) {
+			logError(err, "pubsub_error", "", "", "Redis sharded pub/sub error")
+			select {
+			case <-time.After(shardedSubErrorRetryWait):
+			case <-s.stop:
+				return
+			}
+			s.recoverConn(pubsub)
+		}
+	}
+}
+
+// recoverConn resubscribes unless the connection was already replaced. The
+// client reconnects by itself, but without routing the connection by the
+// subscribed channels, so it's replaced instead.
+func (s *shardSub) recoverConn(pubsub *redisCluster.PubSub) {
+	s.parent.cluster.ReloadState(context.Background())
+
+	s.parent.mu.Lock()
+	defer s.parent.mu.Unlock()
+	if !s.isStopped() && s.pubsub == pubsub {
+		s.resubscribe()
+	}
+}
+
+// resubscribe replaces the subscription connection with a new one routed to
+// the current owner of the slot. It must be called with the parent lock held.
+func (s *shardSub) resubscribe() {
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+
+	old := s.pubsub
+	s.pubsub = s.parent.cluster.SSubscribe(ctx)
+	old.Close()
+
+	// On errors, the receive loop fails and recovers the connection again.
+	if err := s.pubsub.SSubscribe(ctx, channels...); err != nil {
+		logError(err, "subscribe_error", "", strings.Join(channels, "; "), "Redis SSubscribe command error")
+	}
+}
+
+func (s *shardSub) isReplaced(pubsub *redisCluster.PubSub) bool {
+	s.parent.mu.Lock()
+	defer s.parent.mu.Unlock()
+	return s.pubsub != pubsub
+}
+
+func (s *shardSub) isSubscribed(channel string) bool {
+	s.parent.mu.Lock()
+	defer s.parent.mu.Unlock()
+	return s.channels[channel]
+}
+
+func (s *shardSub) isStopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func channelsBySlot(channels []interface{}) map[int][]string {
+	bySlot := map[int][]string{}
+	for _, channel := range channels {
+		name := channel.(string)
+		slot := keySlot(name)
+		bySlot[slot] = append(bySlot[slot], name)
+	}
+	return bySlot
+}
+
+// keySlot returns the cluster slot of key, which is the CRC16 of the key, or of
+// its hash tag when there is one, modulo the number of slots.
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by Redis Cluster.
+func crc16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
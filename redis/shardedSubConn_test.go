@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeySlot(t *testing.T) {
+	Convey("crc16", t, func() {
+		Convey("It should match the reference value of the Redis Cluster spec", func() {
+			So(crc16("123456789"), ShouldEqual, 0x31C3)
+		})
+	})
+
+	Convey("keySlot", t, func() {
+		Convey("It should match the slots computed by Redis", func() {
+			So(keySlot("foo"), ShouldEqual, 12182)
+			So(keySlot("hello"), ShouldEqual, 866)
+			So(keySlot("somekey"), ShouldEqual, 11058)
+			So(keySlot(""), ShouldEqual, 0)
+		})
+
+		Convey("It should only hash the hash tag of keys having one", func() {
+			So(keySlot("{user1000}.following"), ShouldEqual, keySlot("user1000"))
+			So(keySlot("{user1000}.followers"), ShouldEqual, keySlot("user1000"))
+			So(keySlot("foo{{bar}}zap"), ShouldEqual, keySlot("{bar"))
+			So(keySlot("foo{bar}{zap}"), ShouldEqual, keySlot("bar"))
+		})
+
+		Convey("It should hash the whole key when the hash tag is empty or unclosed", func() {
+			So(keySlot("foo{}{bar}"), ShouldEqual, int(crc16("foo{}{bar}"))%clusterSlots)
+			So(keySlot("foo{}{bar}"), ShouldNotEqual, keySlot("bar"))
+			So(keySlot("foo{bar"), ShouldEqual, int(crc16("foo{bar"))%clusterSlots)
+		})
+	})
+}
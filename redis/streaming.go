@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtex/go-io/cache"
+)
+
+const (
+	streamChunkSize = 512 * 1024
+	// Chunks live a little longer than the manifest pointing to them, so that
+	// they don't expire while a reader that got the manifest is consuming them.
+	streamChunkTTLMargin = 1 * time.Minute
+	// streamInlineMarker prefixes values saved inline in the key of a streamed
+	// value, telling them apart from JSON manifests.
+	streamInlineMarker = 0
+)
+
+// streamManifest is saved in the key of a streamed value split in chunks. The
+// chunks are saved in separate keys, identified by a random generation so that
+// concurrent writers never overwrite chunks a reader is still consuming. Values
+// that fit in a single chunk are saved raw in the key instead, prefixed by
+// streamInlineMarker.
+type streamManifest struct {
+	Generation string
+	Chunks     int
+	Size       int64
+}
+
+// StreamingCache is a Cache which also stores and serves values as streams,
+// split in chunks. It is kept apart from Cache so that implementations of Cache
+// don't need to support streaming. The clients returned by New implement it,
+// e.g. New(conf).(StreamingCache).
+type StreamingCache interface {
+	Cache
+	cache.Streaming
+}
+
+func (r *redisC) GetReader(key string) (io.ReadCloser, bool, error) {
+	var data []byte
+	cached, err := r.Get(key, &data)
+	if err != nil || !cached {
+		return nil, false, err
+	}
+
+	if len(data) > 0 && data[0] == streamInlineMarker {
+		return &chunkReader{current: data[1:]}, true, nil
+	}
+
+	var manifest streamManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, false, errors.Wrap(err, "Failed to unmarshal streamed value manifest")
+	} else if manifest.Chunks == 0 {
+		return nil, false, nil
+	}
+
+	chunkKeys := make([]string, manifest.Chunks)
+	for i := range chunkKeys {
+		chunkKeys[i] = streamChunkKey(key, manifest.Generation, i)
+	}
+	return &chunkReader{redis: r, chunkKeys: chunkKeys}, true, nil
+}
+
+func (r *redisC) SetFromReader(key string, reader io.Reader, duration time.Duration) error {
+	if _, err := r.remoteKey(key); err != nil {
+		return err
+	}
+
+	manifestTTL := minDuration(duration, maxRedisCacheDuration-streamChunkTTLMargin)
+	chunkTTL := manifestTTL + streamChunkTTLMargin
+
+	generation, err := newStreamGeneration()
+	if err != nil {
+		return err
+	}
+
+	manifest := streamManifest{Generation: generation}
+	var inline []byte
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			r.delChunks(key, manifest)
+			return errors.Wrap(readErr, "Failed reading value to stream into Redis")
+		}
+		if n == 0 {
+			break
+		}
+
+		manifest.Size += int64(n)
+		if manifest.Chunks == 0 && readErr != nil {
+			// Everything fit in the first chunk, so save it inline.
+			inline = buf[:n]
+			break
+		}
+
+		chunkKey := streamChunkKey(key, generation, manifest.Chunks)
+		if _, err := r.SetOpt(chunkKey, buf[:n], SetOptions{ExpireIn: chunkTTL}); err != nil {
+			r.delChunks(key, manifest)
+			return errors.Wrap(err, "Failed saving value chunk to Redis")
+		}
+		manifest.Chunks++
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	var value interface{} = manifest
+	if manifest.Chunks == 0 {
+		value = append([]byte{streamInlineMarker}, inline...)
+	}
+	if _, err := r.SetOpt(key, value, SetOptions{ExpireIn: manifestTTL}); err != nil {
+		r.delChunks(key, manifest)
+		return err
+	}
+	return nil
+}
+
+func (r *redisC) delChunks(key string, manifest streamManifest) {
+	for i := 0; i < manifest.Chunks; i++ {
+		r.Del(streamChunkKey(key, manifest.Generation, i))
+	}
+}
+
+func streamChunkKey(key, generation string, idx int) string {
+	return key + ":chunk:" + generation + ":" + strconv.Itoa(idx)
+}
+
+func newStreamGeneration() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "Failed to generate stream generation")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// chunkReader lazily reads the chunks of a streamed value from Redis.
+type chunkReader struct {
+	redis     *redisC
+	chunkKeys []string
+	current   []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.current) == 0 {
+		if len(c.chunkKeys) == 0 {
+			return 0, io.EOF
+		}
+
+		cached, err := c.redis.Get(c.chunkKeys[0], &c.current)
+		if err != nil {
+			return 0, err
+		} else if !cached {
+			return 0, errors.Errorf("Chunk %s of streamed value not found", c.chunkKeys[0])
+		}
+		c.chunkKeys = c.chunkKeys[1:]
+	}
+
+	n := copy(p, c.current)
+	c.current = c.current[n:]
+	return n, nil
+}
+
+func (c *chunkReader) Close() error {
+	c.chunkKeys = nil
+	c.current = nil
+	return nil
+}
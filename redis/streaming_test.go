@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreaming(t *testing.T) {
+	Convey("Streaming", t, func() {
+		server := newFakeServer(t)
+		client := New(RedisConfig{Endpoint: server.Addr(), KeyNamespace: "test"})
+		defer client.(*redisC).Close()
+		subject := client.(StreamingCache)
+
+		readAll := func(key string) ([]byte, bool, error) {
+			reader, ok, err := subject.GetReader(key)
+			if err != nil || !ok {
+				return nil, ok, err
+			}
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			return data, true, err
+		}
+
+		Convey("It should save small values raw in a single key", func() {
+			So(subject.SetFromReader("small", bytes.NewReader([]byte("hello")), time.Minute), ShouldBeNil)
+			So(server.Calls("SET"), ShouldEqual, 1)
+			So(server.LastArgs("SET")[:2], ShouldResemble, []string{"test:small", "\x00hello"})
+
+			data, ok, err := readAll("small")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(string(data), ShouldEqual, "hello")
+		})
+
+		Convey("It should save empty values", func() {
+			So(subject.SetFromReader("empty", bytes.NewReader(nil), time.Minute), ShouldBeNil)
+
+			data, ok, err := readAll("empty")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(data, ShouldBeEmpty)
+		})
+
+		Convey("It should split large values in chunks", func() {
+			value := bytes.Repeat([]byte("0123456789"), streamChunkSize/4)
+			So(subject.SetFromReader("large", bytes.NewReader(value), time.Minute), ShouldBeNil)
+			So(server.Calls("SET"), ShouldEqual, 4)
+
+			var manifest streamManifest
+			found, err := subject.Get("large", &manifest)
+			So(err, ShouldBeNil)
+			So(found, ShouldBeTrue)
+			So(manifest.Chunks, ShouldEqual, 3)
+			So(manifest.Size, ShouldEqual, len(value))
+
+			var chunk []byte
+			found, err = subject.Get(streamChunkKey("large", manifest.Generation, 2), &chunk)
+			So(err, ShouldBeNil)
+			So(found, ShouldBeTrue)
+			So(len(chunk), ShouldEqual, len(value)-2*streamChunkSize)
+
+			data, ok, err := readAll("large")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(bytes.Equal(data, value), ShouldBeTrue)
+		})
+
+		Convey("It should only save the manifest on EOF", func() {
+			reader, writer := io.Pipe()
+			done := make(chan error, 1)
+			go func() { done <- subject.SetFromReader("piped", reader, time.Minute) }()
+
+			// The extra byte is only consumed after the first chunk is saved.
+			_, err := writer.Write(make([]byte, streamChunkSize+1))
+			So(err, ShouldBeNil)
+			So(server.Calls("SET"), ShouldEqual, 1)
+			exists, err := subject.Exists("piped")
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+
+			So(writer.Close(), ShouldBeNil)
+			So(<-done, ShouldBeNil)
+			So(server.Calls("SET"), ShouldEqual, 3)
+			So(server.LastArgs("SET")[0], ShouldEqual, "test:piped")
+
+			data, ok, err := readAll("piped")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(len(data), ShouldEqual, streamChunkSize+1)
+		})
+
+		Convey("It should delete the saved chunks of an aborted write", func() {
+			reader, writer := io.Pipe()
+			done := make(chan error, 1)
+			go func() { done <- subject.SetFromReader("aborted", reader, time.Minute) }()
+
+			_, err := writer.Write(make([]byte, 2*streamChunkSize+1))
+			So(err, ShouldBeNil)
+			writer.CloseWithError(errors.New("client disconnected"))
+			So(<-done, ShouldNotBeNil)
+
+			So(server.Calls("SET"), ShouldEqual, 2)
+			So(server.Calls("DEL"), ShouldEqual, 2)
+			So(server.LastArgs("DEL")[0], ShouldStartWith, "test:aborted:chunk:")
+			_, ok, err := readAll("aborted")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("It should fail reading a value with a missing chunk", func() {
+			value := make([]byte, 2*streamChunkSize)
+			So(subject.SetFromReader("missing", bytes.NewReader(value), time.Minute), ShouldBeNil)
+
+			var manifest streamManifest
+			_, err := subject.Get("missing", &manifest)
+			So(err, ShouldBeNil)
+			So(subject.Del(streamChunkKey("missing", manifest.Generation, 1)), ShouldBeNil)
+
+			reader, ok, err := subject.GetReader("missing")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "not found")
+			So(len(data), ShouldEqual, streamChunkSize)
+		})
+
+		Convey("It should report values which are not cached", func() {
+			_, ok, err := readAll("nothing")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
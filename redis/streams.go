@@ -0,0 +1,493 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	redisCluster "github.com/redis/go-redis/v9"
+)
+
+const (
+	streamDataField              = "data"
+	defaultStreamBatchSize       = 10
+	defaultStreamBlock           = 2 * time.Second
+	defaultStreamClaimMinIdle    = 1 * time.Minute
+	defaultStreamClaimInterval   = 30 * time.Second
+	streamConsumerErrorRetryWait = 1 * time.Second
+)
+
+// StreamMessage is an entry of a stream delivered to a consumer group. It is
+// delivered again, possibly to another consumer, until acknowledged with Ack.
+type StreamMessage struct {
+	ID string
+	// Data is nil for entries added without it, e.g. by other clients.
+	Data []byte
+
+	ack func() error
+}
+
+// Ack acknowledges that the message was processed, so that it is not delivered
+// again.
+func (m *StreamMessage) Ack() error {
+	return m.ack()
+}
+
+type StreamChan <-chan *StreamMessage
+
+type ConsumerOptions struct {
+	// Group is the consumer group, created when missing. Each message is
+	// delivered to a single consumer of each group.
+	Group string
+	// Consumer identifies the consumer in the group. It should be stable across
+	// restarts (e.g. the host name), since on start the consumer first receives
+	// the messages it had not acknowledged.
+	Consumer string
+	// FromStart makes a group created by the consumer receive the messages that
+	// are already in the stream, instead of only new ones.
+	FromStart bool
+	// BatchSize is how many messages are read at once. Defaults to 10.
+	BatchSize int64
+	// Block is how long each read waits for new messages. Defaults to 2s.
+	Block time.Duration
+	// Messages not acknowledged by other consumers for ClaimMinIdle, e.g.
+	// because they died, are claimed by this consumer every ClaimInterval.
+	// Default to 1min and 30s respectively.
+	ClaimMinIdle  time.Duration
+	ClaimInterval time.Duration
+}
+
+func (o ConsumerOptions) withDefaults() ConsumerOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultStreamBatchSize
+	}
+	if o.Block <= 0 {
+		o.Block = defaultStreamBlock
+	}
+	if o.ClaimMinIdle <= 0 {
+		o.ClaimMinIdle = defaultStreamClaimMinIdle
+	}
+	if o.ClaimInterval <= 0 {
+		o.ClaimInterval = defaultStreamClaimInterval
+	}
+	return o
+}
+
+// Streams provides durable messaging with Redis Streams, as opposed to PubSub,
+// in which messages are lost when there are no subscribers listening. Consumer
+// groups require Redis 6.2 or later.
+type Streams interface {
+	Cache
+	// XAdd appends data to the stream, returning the ID of the message. If
+	// maxLen is positive, the stream is trimmed to approximately that length.
+	XAdd(stream string, data []byte, maxLen int64) (string, error)
+	// Consume delivers the messages of the stream for a consumer of a group to
+	// the returned channel, until StopConsuming is called.
+	Consume(stream string, opts ConsumerOptions) (StreamChan, error)
+	StopConsuming(ch StreamChan) error
+}
+
+func NewStreams(conf RedisConfig) Streams {
+	return &redisStreams{
+		redisC:    New(conf).(*redisC),
+		consumers: map[StreamChan]*streamConsumer{},
+	}
+}
+
+type redisStreams struct {
+	*redisC
+
+	consumersLock sync.Mutex
+	consumers     map[StreamChan]*streamConsumer
+}
+
+func (r *redisStreams) XAdd(stream string, data []byte, maxLen int64) (string, error) {
+	stream, err := r.remoteKey(stream)
+	if err != nil {
+		return "", err
+	}
+
+	args := []interface{}{stream}
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	args = append(args, "*", streamDataField, data)
+
+	reply, err := r.doCmd("XADD", args...)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed XADD command on Redis")
+	}
+	id, err := replyBytes(reply)
+	return string(id), err
+}
+
+func (r *redisStreams) Consume(stream string, opts ConsumerOptions) (StreamChan, error) {
+	stream, err := r.remoteKey(stream)
+	if err != nil {
+		return nil, err
+	} else if opts.Group == "" || opts.Consumer == "" {
+		return nil, errors.New("Consumer group and name must not be empty")
+	}
+	opts = opts.withDefaults()
+
+	if err := r.createGroup(stream, opts); err != nil {
+		return nil, err
+	}
+
+	msgChan := make(chan *StreamMessage, opts.BatchSize)
+	consumer := &streamConsumer{
+		streams: r,
+		stream:  stream,
+		opts:    opts,
+		msgChan: msgChan,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.dialConsumer(consumer)
+
+	r.consumersLock.Lock()
+	r.consumers[msgChan] = consumer
+	r.consumersLock.Unlock()
+
+	go consumer.run()
+	return msgChan, nil
+}
+
+func (r *redisStreams) StopConsuming(ch StreamChan) error {
+	r.consumersLock.Lock()
+	consumer, ok := r.consumers[ch]
+	delete(r.consumers, ch)
+	r.consumersLock.Unlock()
+
+	if !ok {
+		return errors.New("Stream consumer not found")
+	}
+	close(consumer.stop)
+	<-consumer.done
+	return nil
+}
+
+func (r *redisStreams) createGroup(stream string, opts ConsumerOptions) error {
+	start := "$"
+	if opts.FromStart {
+		start = "0"
+	}
+
+	_, err := r.doCmd("XGROUP", "CREATE", stream, opts.Group, start, "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrapf(err, "Failed to create consumer group %s", opts.Group)
+	}
+	return nil
+}
+
+func (r *redisStreams) ack(stream, group, id string) error {
+	if _, err := r.doCmd("XACK", stream, group, id); err != nil {
+		return errors.Wrapf(err, "Failed to acknowledge stream message %s", id)
+	}
+	return nil
+}
+
+type streamEntry struct {
+	ID string
+	// Data is nil for entries without the data field.
+	Data []byte
+	// Deleted entries are still pending but were trimmed from the stream, so
+	// they have no fields at all.
+	Deleted bool
+}
+
+// dialConsumer gives the consumer its own connection for reading, since reads
+// block for a while, which would hold connections needed for other commands.
+// Like the connection for subscriptions, it is shared with nothing else. In
+// cluster mode, it's taken from the shared client on the first read instead
+// (see clusterConn).
+func (r *redisStreams) dialConsumer(c *streamConsumer) {
+	if r.cluster != nil {
+		return
+	}
+
+	c.pool = newRedisPool(r.conf.Endpoint, poolOptions{
+		MaxActive:      1,
+		MaxIdle:        1,
+		SetReadTimeout: false,
+		Timeouts:       r.conf.timeouts(),
+		Auth:           r.conf.auth(),
+		TLSConfig:      r.conf.TLSConfig,
+		Sentinel:       r.sentinel,
+	})
+}
+
+// readGroup reads the entries of the consumer after the given ID, where ">"
+// means new entries. Reads block with a timeout longer than the client's.
+func (c *streamConsumer) readGroup(id string) ([]streamEntry, error) {
+	opts := c.opts
+	defer c.streams.conf.TimeTracker(commandKpiName("XREADGROUP"), time.Now())
+
+	if c.streams.cluster != nil {
+		conn, err := c.clusterConn()
+		if err != nil {
+			return nil, err
+		}
+		streams, err := conn.XReadGroup(context.Background(), &redisCluster.XReadGroupArgs{
+			Group:    opts.Group,
+			Consumer: opts.Consumer,
+			Streams:  []string{c.stream, id},
+			Count:    opts.BatchSize,
+			Block:    opts.Block,
+		}).Result()
+		if err == redisCluster.Nil {
+			return nil, nil
+		} else if err != nil {
+			// The stream may have moved to another node, so the connection is
+			// taken again on the next read.
+			c.conn.Close()
+			c.conn = nil
+			c.streams.cluster.ReloadState(context.Background())
+			return nil, err
+		} else if len(streams) == 0 {
+			return nil, nil
+		}
+		return clusterStreamEntries(streams[0].Messages), nil
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	reply, err := redis.Values(redis.DoWithTimeout(conn, opts.Block+c.streams.conf.ReadTimeout,
+		"XREADGROUP", "GROUP", opts.Group, opts.Consumer, "COUNT", opts.BatchSize,
+		"BLOCK", opts.Block.Milliseconds(), "STREAMS", c.stream, id))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil || len(reply) == 0 {
+		return nil, err
+	}
+
+	// The reply is [[stream, entries]] for the single stream read.
+	streamReply, err := redis.Values(reply[0], nil)
+	if err != nil || len(streamReply) != 2 {
+		return nil, errors.Errorf("Unexpected XREADGROUP reply: %v", reply)
+	}
+	return poolStreamEntries(streamReply[1])
+}
+
+// clusterConn returns the connection of the consumer to the master owning the
+// stream, taking it from the shared cluster client if there is none.
+func (c *streamConsumer) clusterConn() (*redisCluster.Conn, error) {
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	ctx, cancel := c.streams.commandContext("XREADGROUP")
+	defer cancel()
+	node, err := c.streams.cluster.MasterForKey(ctx, c.stream)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to find the master of stream %s", c.stream)
+	}
+	c.conn = node.Conn()
+	return c.conn, nil
+}
+
+// autoClaim claims entries idle for longer than ClaimMinIdle, starting at the
+// given ID, returning the ID to start the next call, which is "0-0" when all
+// entries were visited.
+func (r *redisStreams) autoClaim(stream, start string, opts ConsumerOptions) ([]streamEntry, string, error) {
+	if r.cluster != nil {
+		defer r.conf.TimeTracker(commandKpiName("XAUTOCLAIM"), time.Now())
+
+		ctx, cancel := r.commandContext("XAUTOCLAIM")
+		defer cancel()
+		messages, next, err := r.cluster.XAutoClaim(ctx, &redisCluster.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    opts.Group,
+			Consumer: opts.Consumer,
+			MinIdle:  opts.ClaimMinIdle,
+			Start:    start,
+			Count:    opts.BatchSize,
+		}).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		return clusterStreamEntries(messages), next, nil
+	}
+
+	reply, err := redis.Values(r.doCmd("XAUTOCLAIM", stream, opts.Group,
+		opts.Consumer, opts.ClaimMinIdle.Milliseconds(), start, "COUNT", opts.BatchSize))
+	if err != nil {
+		return nil, "", err
+	} else if len(reply) < 2 {
+		return nil, "", errors.Errorf("Unexpected XAUTOCLAIM reply: %v", reply)
+	}
+
+	next, err := replyBytes(reply[0])
+	if err != nil {
+		return nil, "", err
+	}
+	entries, err := poolStreamEntries(reply[1])
+	return entries, string(next), err
+}
+
+func clusterStreamEntries(messages []redisCluster.XMessage) []streamEntry {
+	entries := make([]streamEntry, 0, len(messages))
+	for _, msg := range messages {
+		entry := streamEntry{ID: msg.ID, Deleted: msg.Values == nil}
+		if data, ok := msg.Values[streamDataField].(string); ok {
+			entry.Data = []byte(data)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// poolStreamEntries parses entries replied as [[id, [field, value, ...]], ...].
+func poolStreamEntries(reply interface{}) ([]streamEntry, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]streamEntry, 0, len(values))
+	for _, value := range values {
+		entryReply, err := redis.Values(value, nil)
+		if err != nil || len(entryReply) != 2 {
+			return nil, errors.Errorf("Unexpected stream entry: %v", value)
+		}
+		id, err := replyBytes(entryReply[0])
+		if err != nil {
+			return nil, err
+		}
+
+		entry := streamEntry{ID: string(id), Deleted: true}
+		if entryReply[1] != nil {
+			fields, err := replyBytesMap(entryReply[1], nil)
+			if err != nil {
+				return nil, err
+			}
+			entry.Data, entry.Deleted = fields[streamDataField], false
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+type streamConsumer struct {
+	streams *redisStreams
+	stream  string
+	opts    ConsumerOptions
+	msgChan chan *StreamMessage
+	stop    chan struct{}
+	done    chan struct{}
+
+	// Reads go through either pool or conn, which is only used by the consumer
+	// goroutine (see dialConsumer).
+	pool *redis.Pool
+	conn *redisCluster.Conn
+}
+
+func (c *streamConsumer) run() {
+	defer close(c.done)
+	defer close(c.msgChan)
+	defer c.close()
+
+	// Starts with the entries delivered to this consumer but not acknowledged,
+	// e.g. before a restart.
+	pendingID := "0"
+	lastClaim := time.Time{}
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		if time.Since(lastClaim) >= c.opts.ClaimInterval {
+			if !c.claim() {
+				return
+			}
+			lastClaim = time.Now()
+		}
+
+		readID := ">"
+		if pendingID != "" {
+			readID = pendingID
+		}
+		entries, err := c.readGroup(readID)
+		if err != nil {
+			logError(err, "stream_read_error", c.streams.conf.KeyNamespace, c.stream, "Error reading from Redis stream")
+			if !c.wait(streamConsumerErrorRetryWait) {
+				return
+			}
+			continue
+		}
+
+		if pendingID != "" {
+			if len(entries) == 0 {
+				pendingID = ""
+			} else {
+				pendingID = entries[len(entries)-1].ID
+			}
+		}
+		if !c.deliver(entries) {
+			return
+		}
+	}
+}
+
+// claim takes over the entries idle for too long, returning false if stopped.
+func (c *streamConsumer) claim() bool {
+	for start := "0-0"; ; {
+		entries, next, err := c.streams.autoClaim(c.stream, start, c.opts)
+		if err != nil {
+			logError(err, "stream_claim_error", c.streams.conf.KeyNamespace, c.stream, "Error claiming Redis stream messages")
+			return true
+		}
+		if !c.deliver(entries) {
+			return false
+		}
+		if next == "0-0" || next == "" {
+			return true
+		}
+		start = next
+	}
+}
+
+func (c *streamConsumer) deliver(entries []streamEntry) bool {
+	for _, entry := range entries {
+		id := entry.ID
+		ack := func() error {
+			return c.streams.ack(c.stream, c.opts.Group, id)
+		}
+		if entry.Deleted {
+			// Nothing left to deliver, so just remove it from the pending entries.
+			ack()
+			continue
+		}
+
+		select {
+		case c.msgChan <- &StreamMessage{ID: id, Data: entry.Data, ack: ack}:
+		case <-c.stop:
+			return false
+		}
+	}
+	return true
+}
+
+func (c *streamConsumer) close() {
+	if c.pool != nil {
+		c.pool.Close()
+	} else if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *streamConsumer) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.stop:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreams(t *testing.T) {
+	for _, clusterMode := range []bool{false, true} {
+		Convey("Streams", t, func() {
+			server := newFakeServer(t)
+			conf := RedisConfig{
+				Endpoint:       server.Addr(),
+				KeyNamespace:   "test",
+				ClusterMode:    clusterMode,
+				MaxActiveConns: 1,
+				MaxIdleConns:   1,
+			}
+			if clusterMode {
+				// The connection of consumers is taken from the pool of the node.
+				conf.MaxActiveConns = 2
+			}
+			subject := NewStreams(conf)
+			defer subject.(*redisStreams).Close()
+
+			stream := "events"
+			key, _ := subject.(*redisStreams).remoteKey(stream)
+			opts := ConsumerOptions{Group: "group", Consumer: "consumer", FromStart: true, Block: 500 * time.Millisecond}
+
+			receive := func(ch StreamChan) *StreamMessage {
+				select {
+				case msg := <-ch:
+					return msg
+				case <-time.After(2 * time.Second):
+					t.Error("No message received")
+					return nil
+				}
+			}
+
+			Convey("It should deliver messages until they are acknowledged", func() {
+				id, err := subject.XAdd(stream, []byte("hello"), 0)
+				So(err, ShouldBeNil)
+
+				ch, err := subject.Consume(stream, opts)
+				So(err, ShouldBeNil)
+				msg := receive(ch)
+				So(msg.ID, ShouldEqual, id)
+				So(string(msg.Data), ShouldEqual, "hello")
+				So(server.Pending(key, opts.Group), ShouldResemble, []string{id})
+
+				So(msg.Ack(), ShouldBeNil)
+				So(server.Pending(key, opts.Group), ShouldBeEmpty)
+				So(subject.StopConsuming(ch), ShouldBeNil)
+			})
+
+			Convey("It should deliver messages not acknowledged before a restart again", func() {
+				id, _ := subject.XAdd(stream, []byte("hello"), 0)
+				ch, _ := subject.Consume(stream, opts)
+				So(receive(ch).ID, ShouldEqual, id)
+				So(subject.StopConsuming(ch), ShouldBeNil)
+
+				ch, _ = subject.Consume(stream, opts)
+				defer subject.StopConsuming(ch)
+				So(receive(ch).ID, ShouldEqual, id)
+			})
+
+			Convey("It should deliver entries without data with nil data", func() {
+				reply, err := subject.(*redisStreams).doCmd("XADD", key, "*", "other", "value")
+				So(err, ShouldBeNil)
+				id, _ := replyBytes(reply)
+
+				ch, _ := subject.Consume(stream, opts)
+				defer subject.StopConsuming(ch)
+				msg := receive(ch)
+				So(msg.ID, ShouldEqual, string(id))
+				So(msg.Data, ShouldBeNil)
+				So(server.Pending(key, opts.Group), ShouldResemble, []string{string(id)})
+			})
+
+			Convey("It should acknowledge pending entries deleted from the stream without delivering them", func() {
+				deleted, _ := subject.XAdd(stream, []byte("deleted"), 0)
+				ch, _ := subject.Consume(stream, opts)
+				So(receive(ch).ID, ShouldEqual, deleted)
+				So(subject.StopConsuming(ch), ShouldBeNil)
+
+				_, err := subject.(*redisStreams).doCmd("XDEL", key, deleted)
+				So(err, ShouldBeNil)
+				id, _ := subject.XAdd(stream, []byte("hello"), 0)
+
+				ch, _ = subject.Consume(stream, opts)
+				defer subject.StopConsuming(ch)
+				So(receive(ch).ID, ShouldEqual, id)
+				So(server.Pending(key, opts.Group), ShouldResemble, []string{id})
+			})
+
+			Convey("It should not hold the connections of the client while waiting for messages", func() {
+				ch, _ := subject.Consume(stream, opts)
+				defer subject.StopConsuming(ch)
+
+				deadline := time.Now().Add(time.Second)
+				for server.Calls("XREADGROUP") < 2 && time.Now().Before(deadline) {
+					time.Sleep(5 * time.Millisecond)
+				}
+
+				start := time.Now()
+				So(subject.Set("key", 1, time.Minute), ShouldBeNil)
+				So(time.Since(start), ShouldBeLessThan, opts.Block/2)
+			})
+
+			if clusterMode {
+				Convey("It should read through a connection of the shared client", func() {
+					ch, _ := subject.Consume(stream, opts)
+					defer subject.StopConsuming(ch)
+
+					deadline := time.Now().Add(time.Second)
+					for server.Calls("XREADGROUP") < 2 && time.Now().Before(deadline) {
+						time.Sleep(5 * time.Millisecond)
+					}
+					stats := subject.(*redisStreams).cluster.PoolStats()
+					So(server.Conns(), ShouldEqual, stats.TotalConns)
+				})
+			}
+		})
+	}
+}
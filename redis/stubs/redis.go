@@ -1,6 +1,7 @@
 package stubs
 
 import (
+	"io"
 	"time"
 
 	"github.com/vtex/go-io/redis"
@@ -50,3 +51,56 @@ func (c *stubRedis) Del(key string) error {
 func (c *stubRedis) Incr(key string) (int64, error) {
 	return 0, nil
 }
+
+func (c *stubRedis) GetReader(key string) (io.ReadCloser, bool, error) {
+	return nil, false, nil
+}
+
+func (c *stubRedis) SetFromReader(key string, r io.Reader, duration time.Duration) error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func (c *stubRedis) HGet(key, field string, result interface{}) (bool, error) {
+	return false, nil
+}
+
+func (c *stubRedis) HSet(key, field string, value interface{}) error {
+	return nil
+}
+
+func (c *stubRedis) HGetAll(key string, result interface{}) (bool, error) {
+	return false, nil
+}
+
+func (c *stubRedis) HIncrBy(key, field string, incr int64) (int64, error) {
+	return 0, nil
+}
+
+func (c *stubRedis) SAdd(key string, members ...interface{}) (int64, error) {
+	return int64(len(members)), nil
+}
+
+func (c *stubRedis) SIsMember(key string, member interface{}) (bool, error) {
+	return false, nil
+}
+
+func (c *stubRedis) SMembers(key string, result interface{}) error {
+	return nil
+}
+
+func (c *stubRedis) ZAdd(key string, members ...redis.ZMember) (int64, error) {
+	return int64(len(members)), nil
+}
+
+func (c *stubRedis) ZRangeByScore(key string, min, max float64, result interface{}) error {
+	return nil
+}
+
+func (c *stubRedis) ZRem(key string, members ...interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (c *stubRedis) Eval(script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, nil
+}
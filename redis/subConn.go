@@ -2,12 +2,14 @@ package redis
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	goErrors "errors"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
+	redisCluster "github.com/redis/go-redis/v9"
 )
 
 const (
@@ -24,53 +26,135 @@ type subConn struct {
 	pool *redis.Pool
 
 	outputChan      chan redis.Message
-	subscribeChan   chan []interface{}
-	unsubscribeChan chan []interface{}
+	subscribeChan   chan subRequest
+	unsubscribeChan chan subRequest
+	// masterChanged receives on Sentinel failovers, and is nil otherwise.
+	masterChanged <-chan string
+	sentinel      *sentinelResolver
+
+	// stop is closed by Close, and done once the main loop has stopped.
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func newSubConn(endpoint string) (*subConn, error) {
+// newSubConn creates the connection for subscriptions. It uses the timeouts in
+// conf, which must have its defaults applied, except for reading, since the
+// connection blocks waiting for messages. In Sentinel mode, sentinel must be
+// the resolver of the master. In cluster mode, where messages are propagated to
+// all nodes so that subscribing to any of them suffices, cluster is the client
+// used to find other nodes when the endpoint is unreachable.
+func newSubConn(conf RedisConfig, sentinel *sentinelResolver, cluster *redisCluster.ClusterClient) (*subConn, error) {
 	subConn := &subConn{
-		pool: newRedisPool(endpoint, poolOptions{
+		pool: newRedisPool(conf.Endpoint, poolOptions{
 			MaxActive:      3,
 			MaxIdle:        1,
 			SetReadTimeout: false,
+			Timeouts:       conf.timeouts(),
+			Auth:           conf.auth(),
+			TLSConfig:      conf.TLSConfig,
+			Sentinel:       sentinel,
+			Cluster:        cluster,
 		}),
 		outputChan:      make(chan redis.Message, channelsBuffersSize),
-		subscribeChan:   make(chan []interface{}, channelsBuffersSize),
-		unsubscribeChan: make(chan []interface{}, channelsBuffersSize),
+		subscribeChan:   make(chan subRequest, channelsBuffersSize),
+		unsubscribeChan: make(chan subRequest, channelsBuffersSize),
+		sentinel:        sentinel,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	if sentinel != nil {
+		subConn.masterChanged = sentinel.Listen()
 	}
 
 	err := startMainLoop(subConn)
 	if err != nil {
+		subConn.release()
 		return nil, err
 	}
 	return subConn, nil
 }
 
+// Close stops the main loop, closing the connection and the receive channel
+// once it has stopped.
+func (c *subConn) Close() {
+	c.closeOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+func (c *subConn) isStopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *subConn) release() {
+	c.pool.Close()
+	if c.sentinel != nil {
+		c.sentinel.Unlisten(c.masterChanged)
+	}
+}
+
+// subRequest asks the main loop to (un)subscribe to patterns or channels.
+type subRequest struct {
+	kind  subKind
+	names []interface{}
+}
+
 func (c *subConn) PSubscribe(patterns []interface{}) error {
 	if len(patterns) == 0 {
 		return errors.New("Must send at least one pattern to subscribe")
 	}
-
-	select {
-	case c.subscribeChan <- patterns:
-		return nil
-	case <-time.After(subscribeTimeout):
-		return errors.New("Timeout sending patterns to subscriptions channel")
-	}
+	return c.subscribe(subRequest{patternSub, patterns})
 }
 
 func (c *subConn) PUnsubscribe(patterns []interface{}) error {
 	if len(patterns) == 0 {
 		return errors.New("Must send at least one pattern to unsubscribe")
 	}
+	c.unsubscribe(subRequest{patternSub, patterns})
+	return nil
+}
+
+func (c *subConn) Subscribe(channels []interface{}) error {
+	if len(channels) == 0 {
+		return errors.New("Must send at least one channel to subscribe")
+	}
+	return c.subscribe(subRequest{channelSub, channels})
+}
+
+func (c *subConn) Unsubscribe(channels []interface{}) error {
+	if len(channels) == 0 {
+		return errors.New("Must send at least one channel to unsubscribe")
+	}
+	c.unsubscribe(subRequest{channelSub, channels})
+	return nil
+}
 
+func (c *subConn) subscribe(req subRequest) error {
+	if c.isStopped() {
+		return errors.New("Subscriptions connection is closed")
+	}
+	select {
+	case c.subscribeChan <- req:
+		return nil
+	case <-time.After(subscribeTimeout):
+		return errors.New("Timeout sending patterns or channels to subscriptions channel")
+	}
+}
+
+func (c *subConn) unsubscribe(req subRequest) {
 	// Since this is almost a clean-up done after the consumers are done with us,
 	// we don't have a timeout here so we don't risk leaving an inconsistent state.
 	// If we have any problems with this, consider moving this to a background
 	// routine so we don't block the caller.
-	c.unsubscribeChan <- patterns
-	return nil
+	select {
+	case c.unsubscribeChan <- req:
+	case <-c.stop:
+	}
 }
 
 func (c *subConn) ReceiveChan() <-chan redis.Message {
@@ -80,6 +164,7 @@ func (c *subConn) ReceiveChan() <-chan redis.Message {
 type pubSubLoopState struct {
 	parent             *subConn
 	subscribedPatterns map[interface{}]bool
+	subscribedChannels map[interface{}]bool
 
 	pingTicker      <-chan time.Time
 	pongTimeoutChan <-chan time.Time
@@ -93,6 +178,7 @@ func startMainLoop(parent *subConn) error {
 	loopState := &pubSubLoopState{
 		parent:             parent,
 		subscribedPatterns: map[interface{}]bool{},
+		subscribedChannels: map[interface{}]bool{},
 		pingTicker:         time.Tick(pingDelay),
 	}
 	if err := loopState.resetConn(); err != nil {
@@ -100,8 +186,12 @@ func startMainLoop(parent *subConn) error {
 	}
 
 	go func() {
+		defer loopState.close()
 		for {
 			err, errCode, errMsg := loopState.mainIteration()
+			if parent.isStopped() {
+				return
+			}
 			if err != nil {
 				logError(err, errCode, "", "", errMsg)
 				loopState.recoverConn()
@@ -111,8 +201,36 @@ func startMainLoop(parent *subConn) error {
 	return nil
 }
 
+// close closes the connection and then the receive channel, once the main
+// loop has stopped. The connection is quit first, so that the goroutine
+// receiving from it stops before it's closed.
+func (s *pubSubLoopState) close() {
+	if s.currConn.Conn.Send("QUIT") == nil && s.currConn.Conn.Flush() == nil {
+		timeout := time.After(pongTimeout)
+	drain:
+		for {
+			select {
+			case _, ok := <-s.msgChan:
+				if !ok {
+					break drain
+				}
+			case <-timeout:
+				break drain
+			}
+		}
+	}
+	s.closeMsgChan()
+	s.currConn.Close()
+	s.parent.release()
+	close(s.parent.outputChan)
+	close(s.parent.done)
+}
+
 func (s *pubSubLoopState) mainIteration() (err error, errCode, errMsg string) {
 	select {
+	case <-s.parent.stop:
+		return nil, "", ""
+
 	case <-s.pingTicker:
 		err = s.currConn.Ping("")
 		if err != nil {
@@ -132,7 +250,7 @@ func (s *pubSubLoopState) mainIteration() (err error, errCode, errMsg string) {
 			return nil, "", ""
 
 		case redis.Subscription:
-			// This is received as a response to P(UN)SUB cmds and we can simply ignore.
+			// This is received as a response to (P)(UN)SUB cmds and we can simply ignore.
 			return nil, "", ""
 
 		case error:
@@ -144,46 +262,76 @@ func (s *pubSubLoopState) mainIteration() (err error, errCode, errMsg string) {
 		s.pongTimeoutChan = nil
 		return errors.WithStack(pongTimeoutErr), "pong_timeout", "Timed out waiting for Redis ping response"
 
-	case patterns := <-s.parent.subscribeChan:
-		if err = s.currConn.PSubscribe(patterns...); err != nil {
+	case master := <-s.parent.masterChanged:
+		// Subscriptions are moved even if the old master is still reachable, since
+		// it may be partitioned from the new one.
+		return errors.Errorf("Redis master changed to %s", master), "master_changed", "Resubscribing to new Redis master"
+
+	case req := <-s.parent.subscribeChan:
+		if err = subscribeConn(s.currConn, req.kind, req.names); err != nil {
 			// Retry at most once otherwise just drop the subscription request.
 			// This is a safety guard (instead of retrying indefinitely), in case
 			// some bad input is sent to us.
 			s.recoverConn()
-			err = s.currConn.PSubscribe(patterns...)
+			err = subscribeConn(s.currConn, req.kind, req.names)
 			if err != nil {
-				return err, "subscribe_error", "Redis PSubscribe command error"
+				return err, "subscribe_error", "Redis subscribe command error"
 			}
 		}
 
-		for _, pattern := range patterns {
-			s.subscribedPatterns[pattern] = true
+		subscribed := s.subscribed(req.kind)
+		for _, name := range req.names {
+			subscribed[name] = true
 		}
 		return nil, "", ""
 
-	case patterns := <-s.parent.unsubscribeChan:
-		toUnsubscribe := make([]interface{}, 0, len(patterns))
-		for _, pattern := range patterns {
-			if s.subscribedPatterns[pattern] {
-				toUnsubscribe = append(toUnsubscribe, pattern)
-				delete(s.subscribedPatterns, pattern)
+	case req := <-s.parent.unsubscribeChan:
+		subscribed := s.subscribed(req.kind)
+		toUnsubscribe := make([]interface{}, 0, len(req.names))
+		for _, name := range req.names {
+			if subscribed[name] {
+				toUnsubscribe = append(toUnsubscribe, name)
+				delete(subscribed, name)
 			}
 		}
 		if len(toUnsubscribe) == 0 {
 			return nil, "", ""
 		}
 
-		if err = s.currConn.PUnsubscribe(toUnsubscribe...); err != nil {
+		if err = unsubscribeConn(s.currConn, req.kind, toUnsubscribe); err != nil {
 			// We don't need to retry here, since we've already removed the specific subscriptions
-			// from the subscribedPatterns field, so when we recover the connection belo it will
-			// come back already unsubscribed from the requested patterns.
-			return err, "unsubscribe_error", "Redis PUnsubscribe command error"
+			// from the subscribed patterns or channels, so when we recover the connection below it
+			// will come back already unsubscribed from the requested ones.
+			return err, "unsubscribe_error", "Redis unsubscribe command error"
 		}
 		return nil, "", ""
 	}
 }
 
-// Retries to reset pub/sub connection until no error occurrs
+// subscribed returns the set of patterns or channels subscribed, by kind.
+func (s *pubSubLoopState) subscribed(kind subKind) map[interface{}]bool {
+	if kind == channelSub {
+		return s.subscribedChannels
+	}
+	return s.subscribedPatterns
+}
+
+func subscribeConn(psc *redis.PubSubConn, kind subKind, names []interface{}) error {
+	if kind == channelSub {
+		return psc.Subscribe(names...)
+	}
+	return psc.PSubscribe(names...)
+}
+
+func unsubscribeConn(psc *redis.PubSubConn, kind subKind, names []interface{}) error {
+	if kind == channelSub {
+		return psc.Unsubscribe(names...)
+	}
+	return psc.PUnsubscribe(names...)
+}
+
+// Retries to reset pub/sub connection until no error occurrs, or the
+// connection is closed.
 func (s *pubSubLoopState) recoverConn() {
 	err := s.currConn.Conn.Err()
 	logError(err, "redis_conn_recover", "", "", "Recovering Redis connection due to error")
@@ -194,7 +342,11 @@ func (s *pubSubLoopState) recoverConn() {
 			break
 		}
 		logError(err, "redis_conn_reset_error", "", "", "Error resetting Redis connection")
-		time.Sleep(1 * time.Second)
+		select {
+		case <-time.After(1 * time.Second):
+		case <-s.parent.stop:
+			return
+		}
 	}
 }
 
@@ -221,6 +373,17 @@ func (s *pubSubLoopState) resetConn() error {
 		}
 	}
 
+	if len(s.subscribedChannels) > 0 {
+		channels := make([]interface{}, 0, len(s.subscribedChannels))
+		for c := range s.subscribedChannels {
+			channels = append(channels, c)
+		}
+		if err := psc.Subscribe(channels...); err != nil {
+			psc.Close()
+			return errors.Wrapf(err, "Error re-subscribing to channels %s", channels)
+		}
+	}
+
 	if s.currConn != nil {
 		s.closeMsgChan()
 		s.currConn.Close()
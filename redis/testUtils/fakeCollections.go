@@ -0,0 +1,152 @@
+package testUtils
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// The hashes, sets and sorted sets of the fake server don't expire, like those
+// of the package.
+
+func (s *FakeServer) hset(args []string) interface{} {
+	hash, ok := s.hashes[args[0]]
+	if !ok {
+		hash = map[string]string{}
+		s.hashes[args[0]] = hash
+	}
+
+	var added int64
+	for i := 1; i+1 < len(args); i += 2 {
+		if _, exists := hash[args[i]]; !exists {
+			added++
+		}
+		hash[args[i]] = args[i+1]
+	}
+	return added
+}
+
+func (s *FakeServer) hget(args []string) interface{} {
+	if value, ok := s.hashes[args[0]][args[1]]; ok {
+		return value
+	}
+	return nil
+}
+
+func (s *FakeServer) hgetall(args []string) interface{} {
+	reply := []interface{}{}
+	for field, value := range s.hashes[args[0]] {
+		reply = append(reply, field, value)
+	}
+	return reply
+}
+
+func (s *FakeServer) hincrby(args []string) interface{} {
+	n, _ := strconv.ParseInt(s.hashes[args[0]][args[1]], 10, 64)
+	incr, _ := strconv.ParseInt(args[2], 10, 64)
+	n += incr
+	s.hset([]string{args[0], args[1], strconv.FormatInt(n, 10)})
+	return n
+}
+
+func (s *FakeServer) sadd(args []string) interface{} {
+	set, ok := s.sets[args[0]]
+	if !ok {
+		set = map[string]bool{}
+		s.sets[args[0]] = set
+	}
+
+	var added int64
+	for _, member := range args[1:] {
+		if !set[member] {
+			set[member] = true
+			added++
+		}
+	}
+	return added
+}
+
+func (s *FakeServer) sismember(args []string) interface{} {
+	if s.sets[args[0]][args[1]] {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func (s *FakeServer) smembers(args []string) interface{} {
+	reply := []interface{}{}
+	for member := range s.sets[args[0]] {
+		reply = append(reply, member)
+	}
+	return reply
+}
+
+func (s *FakeServer) zadd(args []string) interface{} {
+	zset, ok := s.zsets[args[0]]
+	if !ok {
+		zset = map[string]float64{}
+		s.zsets[args[0]] = zset
+	}
+
+	var added int64
+	for i := 1; i+1 < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return fakeError("ERR value is not a valid float")
+		}
+		if _, exists := zset[args[i+1]]; !exists {
+			added++
+		}
+		zset[args[i+1]] = score
+	}
+	return added
+}
+
+func (s *FakeServer) zrangebyscore(args []string) interface{} {
+	min, minErr := parseScore(args[1])
+	max, maxErr := parseScore(args[2])
+	if minErr != nil || maxErr != nil {
+		return fakeError("ERR min or max is not a float")
+	}
+
+	zset := s.zsets[args[0]]
+	members := []string{}
+	for member, score := range zset {
+		if score >= min && score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if zset[members[i]] != zset[members[j]] {
+			return zset[members[i]] < zset[members[j]]
+		}
+		return members[i] < members[j]
+	})
+
+	reply := make([]interface{}, len(members))
+	for i, member := range members {
+		reply[i] = member
+	}
+	return reply
+}
+
+func (s *FakeServer) zrem(args []string) interface{} {
+	var removed int64
+	for _, member := range args[1:] {
+		if _, ok := s.zsets[args[0]][member]; ok {
+			delete(s.zsets[args[0]], member)
+			removed++
+		}
+	}
+	return removed
+}
+
+func parseScore(score string) (float64, error) {
+	switch score {
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(score, 64)
+}
@@ -0,0 +1,150 @@
+package testUtils
+
+import (
+	"bufio"
+	"net"
+	"path"
+	"strings"
+	"sync"
+)
+
+// fakeConn is a connection to the fake server, which may receive published
+// messages besides the replies to its commands.
+type fakeConn struct {
+	conn net.Conn
+
+	mu sync.Mutex
+	w  *bufio.Writer
+
+	// The subscriptions are guarded by the server lock.
+	subs map[string]map[string]bool
+}
+
+func (s *FakeServer) addConn(conn net.Conn) *fakeConn {
+	c := &fakeConn{conn: conn, w: bufio.NewWriter(conn), subs: map[string]map[string]bool{}}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c] = true
+	return c
+}
+
+func (s *FakeServer) removeConn(c *fakeConn) {
+	c.conn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+// Conns returns how many connections are open.
+func (s *FakeServer) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// DropConns closes all open connections, as on network failures or restarts.
+func (s *FakeServer) DropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+}
+
+// MoveSlot unsubscribes the connections subscribed to the sharded channel, as
+// Redis does when the slot of the channel moves to another shard.
+func (s *FakeServer) MoveSlot(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if subs := c.subs["ssubscribe"]; subs[channel] {
+			delete(subs, channel)
+			c.write([]interface{}{"sunsubscribe", channel, int64(len(subs))})
+		}
+	}
+}
+
+func (c *fakeConn) write(reply interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeReply(c.w, reply)
+	return c.w.Flush()
+}
+
+func (c *fakeConn) subscribed() bool {
+	for _, names := range c.subs {
+		if len(names) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe handles the (un)subscribe commands of all kinds, replying once per
+// pattern or channel, as Redis does.
+func (s *FakeServer) subscribe(c *fakeConn, cmd string, args []string) interface{} {
+	kind := strings.ToLower(cmd)
+	unsubscribe := strings.Contains(kind, "unsubscribe")
+	kind = strings.Replace(kind, "unsubscribe", "subscribe", 1)
+	subs, ok := c.subs[kind]
+	if !ok {
+		subs = map[string]bool{}
+		c.subs[kind] = subs
+	}
+
+	if unsubscribe && len(args) == 0 {
+		for name := range subs {
+			args = append(args, name)
+		}
+		if len(args) == 0 {
+			return []interface{}{strings.ToLower(cmd), nil, int64(0)}
+		}
+	}
+
+	replies := fakeReplies{}
+	for _, name := range args {
+		if unsubscribe {
+			delete(subs, name)
+		} else {
+			subs[name] = true
+		}
+		replies = append(replies, []interface{}{strings.ToLower(cmd), name, int64(c.subsCount(kind))})
+	}
+	return replies
+}
+
+// subsCount returns the number of subscriptions counted in replies, in which
+// sharded channels are counted apart.
+func (c *fakeConn) subsCount(kind string) int {
+	if kind == "ssubscribe" {
+		return len(c.subs[kind])
+	}
+	return len(c.subs["subscribe"]) + len(c.subs["psubscribe"])
+}
+
+// publish sends the message to the subscribed connections, sharded channels
+// being separate from the others.
+func (s *FakeServer) publish(cmd, channel, data string) interface{} {
+	var receivers int64
+	for c := range s.conns {
+		if cmd == "SPUBLISH" {
+			if c.subs["ssubscribe"][channel] {
+				c.write([]interface{}{"smessage", channel, data})
+				receivers++
+			}
+			continue
+		}
+
+		if c.subs["subscribe"][channel] {
+			c.write([]interface{}{"message", channel, data})
+			receivers++
+		}
+		for pattern := range c.subs["psubscribe"] {
+			if matched, _ := path.Match(pattern, channel); matched {
+				c.write([]interface{}{"pmessage", pattern, channel, data})
+				receivers++
+			}
+		}
+	}
+	return receivers
+}
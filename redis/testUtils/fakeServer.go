@@ -0,0 +1,457 @@
+package testUtils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeServer is a minimal in-memory Redis server speaking RESP2, implementing
+// just the commands used by the redis package. Scripts are implemented in Go
+// and registered by the hash of their source (see AddScript).
+type FakeServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	offset   time.Duration
+	strings  map[string]fakeString
+	streams  map[string]*fakeStream
+	hashes   map[string]map[string]string
+	sets     map[string]map[string]bool
+	zsets    map[string]map[string]float64
+	lastSeq  int64
+	calls    map[string]int
+	lastArgs map[string][]string
+	commands [][]string
+	// master is the address returned when acting as a sentinel.
+	master   string
+	failures map[string]string
+	delays   map[string]time.Duration
+	conns    map[*fakeConn]bool
+	scripts  map[string]FakeScript
+	// loaded holds the hashes of the scripts sent with EVAL, which are the only
+	// ones EVALSHA runs, as in Redis.
+	loaded map[string]bool
+}
+
+type fakeString struct {
+	value    []byte
+	expireAt time.Time
+}
+
+type fakeStatus string
+
+type fakeError string
+
+// fakeReplies are several replies to a single command, as to subscriptions.
+type fakeReplies []interface{}
+
+// FakeScript implements a script in Go. It runs with the server locked, so it
+// can use Get, Set, Del and Incr.
+type FakeScript func(s *FakeServer, keys, args []string) interface{}
+
+func NewFakeServer(t *testing.T) *FakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &FakeServer{
+		listener: listener,
+		strings:  map[string]fakeString{},
+		streams:  map[string]*fakeStream{},
+		hashes:   map[string]map[string]string{},
+		sets:     map[string]map[string]bool{},
+		zsets:    map[string]map[string]float64{},
+		calls:    map[string]int{},
+		lastArgs: map[string][]string{},
+		failures: map[string]string{},
+		delays:   map[string]time.Duration{},
+		conns:    map[*fakeConn]bool{},
+		scripts:  map[string]FakeScript{},
+		loaded:   map[string]bool{},
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *FakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// AddScript registers the implementation of the script with the given hash.
+func (s *FakeServer) AddScript(hash string, script FakeScript) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[hash] = script
+}
+
+// FlushScripts forgets the scripts sent with EVAL, as Redis does on restarts.
+func (s *FakeServer) FlushScripts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = map[string]bool{}
+}
+
+// Advance moves the clock of the server forward, expiring keys.
+func (s *FakeServer) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// Calls returns how many times the command was received.
+func (s *FakeServer) Calls(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.ToUpper(cmd)]
+}
+
+// LastArgs returns the arguments the command was last received with.
+func (s *FakeServer) LastArgs(cmd string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastArgs[strings.ToUpper(cmd)]
+}
+
+// Commands returns the commands received so far, in order, with their args.
+func (s *FakeServer) Commands() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.commands...)
+}
+
+// Fail makes the server reply to the commands with an error, or to reply
+// normally again if err is empty.
+func (s *FakeServer) Fail(err string, cmds ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cmd := range cmds {
+		s.failures[strings.ToUpper(cmd)] = err
+	}
+}
+
+// Delay makes the server wait before replying to the commands.
+func (s *FakeServer) Delay(d time.Duration, cmds ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cmd := range cmds {
+		s.delays[strings.ToUpper(cmd)] = d
+	}
+}
+
+// SetMaster sets the master address the server reports as a sentinel.
+func (s *FakeServer) SetMaster(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.master = addr
+}
+
+func (s *FakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *FakeServer) serveConn(conn net.Conn) {
+	c := s.addConn(conn)
+	defer s.removeConn(c)
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if err := c.write(s.do(c, args)); err != nil || strings.ToUpper(args[0]) == "QUIT" {
+			return
+		}
+	}
+}
+
+func (s *FakeServer) do(c *fakeConn, args []string) interface{} {
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+	s.mu.Lock()
+	delay := s.delays[cmd]
+	s.mu.Unlock()
+	time.Sleep(delay)
+	if cmd == "XREADGROUP" {
+		// Blocking reads poll without holding the lock.
+		s.count(cmd, args)
+		return s.xreadgroup(args)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[cmd]++
+	s.lastArgs[cmd] = args
+	s.commands = append(s.commands, append([]string{cmd}, args...))
+	if err := s.failures[cmd]; err != "" {
+		return fakeError(err)
+	}
+
+	switch cmd {
+	case "PING":
+		if c.subscribed() {
+			return []interface{}{"pong", strings.Join(args, "")}
+		}
+		return fakeStatus("PONG")
+	case "AUTH", "SELECT", "QUIT":
+		return fakeStatus("OK")
+	case "ROLE":
+		return []interface{}{"master", int64(0), []interface{}{}}
+	case "SENTINEL":
+		if s.master == "" {
+			return []interface{}(nil)
+		}
+		host, port, _ := net.SplitHostPort(s.master)
+		return []interface{}{host, port}
+	case "CLUSTER":
+		// A single node serves all the slots when acting as a cluster.
+		host, port, _ := net.SplitHostPort(s.Addr())
+		n, _ := strconv.ParseInt(port, 10, 64)
+		return []interface{}{[]interface{}{int64(0), int64(16383), []interface{}{host, n, "fake"}}}
+	case "ECHO":
+		return args[0]
+	case "COMMAND":
+		return []interface{}{}
+	case "XADD":
+		return s.xadd(args)
+	case "XDEL":
+		return s.xdel(args)
+	case "XGROUP":
+		return s.xgroupCreate(args)
+	case "XACK":
+		return s.xack(args)
+	case "XAUTOCLAIM":
+		return s.xautoclaim(args)
+	case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE":
+		return s.subscribe(c, cmd, args)
+	case "PUBLISH", "SPUBLISH":
+		return s.publish(cmd, args[0], args[1])
+	case "HSET":
+		return s.hset(args)
+	case "HGET":
+		return s.hget(args)
+	case "HGETALL":
+		return s.hgetall(args)
+	case "HINCRBY":
+		return s.hincrby(args)
+	case "SADD":
+		return s.sadd(args)
+	case "SISMEMBER":
+		return s.sismember(args)
+	case "SMEMBERS":
+		return s.smembers(args)
+	case "ZADD":
+		return s.zadd(args)
+	case "ZRANGEBYSCORE":
+		return s.zrangebyscore(args)
+	case "ZREM":
+		return s.zrem(args)
+	case "GET":
+		if value, ok := s.Get(args[0]); ok {
+			return value
+		}
+		return nil
+	case "SET":
+		return s.doSet(args)
+	case "DEL":
+		var deleted int64
+		for _, key := range args {
+			if s.Del(key) {
+				deleted++
+			}
+		}
+		return deleted
+	case "EXISTS":
+		var count int64
+		for _, key := range args {
+			if _, ok := s.Get(key); ok {
+				count++
+			}
+		}
+		return count
+	case "INCR":
+		return s.Incr(args[0])
+	case "EVALSHA":
+		if !s.loaded[args[0]] {
+			return fakeError("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return s.eval(args[0], args[1:])
+	case "EVAL":
+		sum := sha1.Sum([]byte(args[0]))
+		hash := hex.EncodeToString(sum[:])
+		s.loaded[hash] = true
+		return s.eval(hash, args[1:])
+	}
+	return fakeError(fmt.Sprintf("ERR unknown command '%s'", cmd))
+}
+
+func (s *FakeServer) count(cmd string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[cmd]++
+	s.lastArgs[cmd] = args
+	s.commands = append(s.commands, append([]string{cmd}, args...))
+}
+
+func (s *FakeServer) doSet(args []string) interface{} {
+	var ttl time.Duration
+	var nx bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX", "PX":
+			n, _ := strconv.Atoi(args[i+1])
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		case "NX":
+			nx = true
+		}
+	}
+
+	if _, exists := s.Get(args[0]); nx && exists {
+		return nil
+	}
+	s.Set(args[0], []byte(args[1]), ttl)
+	return fakeStatus("OK")
+}
+
+func (s *FakeServer) eval(hash string, args []string) interface{} {
+	script, ok := s.scripts[hash]
+	if !ok {
+		return fakeError("ERR unknown fake script " + hash)
+	}
+	numKeys, _ := strconv.Atoi(args[0])
+	return script(s, args[1:1+numKeys], args[1+numKeys:])
+}
+
+// Now returns the time of the server, moved by Advance.
+func (s *FakeServer) Now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// Get returns the string value of key. It must only be called by scripts.
+func (s *FakeServer) Get(key string) ([]byte, bool) {
+	entry, ok := s.strings[key]
+	if ok && !entry.expireAt.IsZero() && !s.Now().Before(entry.expireAt) {
+		delete(s.strings, key)
+		return nil, false
+	}
+	return entry.value, ok
+}
+
+// Set sets the string value of key, expiring after ttl unless it's zero. It
+// must only be called by scripts.
+func (s *FakeServer) Set(key string, value []byte, ttl time.Duration) {
+	entry := fakeString{value: value}
+	if ttl > 0 {
+		entry.expireAt = s.Now().Add(ttl)
+	}
+	s.strings[key] = entry
+}
+
+// Incr increments the integer value of key. It must only be called by scripts.
+func (s *FakeServer) Incr(key string) int64 {
+	value, _ := s.Get(key)
+	n, _ := strconv.ParseInt(string(value), 10, 64)
+	n++
+	s.strings[key] = fakeString{value: []byte(strconv.FormatInt(n, 10))}
+	return n
+}
+
+// Del deletes the string value of key, returning whether it existed. It must
+// only be called by scripts.
+func (s *FakeServer) Del(key string) bool {
+	_, ok := s.Get(key)
+	delete(s.strings, key)
+	return ok
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	} else if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case fakeError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case fakeReplies:
+		for _, elem := range v {
+			writeReply(w, elem)
+		}
+	case []interface{}:
+		if v == nil {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, elem := range v {
+			writeReply(w, elem)
+		}
+	default:
+		panic(fmt.Sprintf("Unsupported fake reply type %T", reply))
+	}
+}
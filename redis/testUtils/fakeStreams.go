@@ -0,0 +1,249 @@
+package testUtils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fakeStream is a stream of the fake server, whose entry IDs come from a
+// sequence shared by all streams, as in "<seq>-0".
+type fakeStream struct {
+	entries []fakeEntry
+	groups  map[string]*fakeGroup
+}
+
+type fakeEntry struct {
+	id     string
+	fields []string
+}
+
+type fakeGroup struct {
+	lastID  string
+	pending map[string]*fakePending
+}
+
+type fakePending struct {
+	consumer    string
+	deliveredAt time.Time
+}
+
+func (s *FakeServer) xadd(args []string) interface{} {
+	key, maxLen := args[0], -1
+	args = args[1:]
+	if strings.ToUpper(args[0]) == "MAXLEN" {
+		if args[1] == "~" || args[1] == "=" {
+			args = args[1:]
+		}
+		maxLen, _ = strconv.Atoi(args[1])
+		args = args[2:]
+	}
+
+	stream, ok := s.streams[key]
+	if !ok {
+		stream = &fakeStream{groups: map[string]*fakeGroup{}}
+		s.streams[key] = stream
+	}
+	s.lastSeq++
+	id := fmt.Sprintf("%d-0", s.lastSeq)
+	stream.entries = append(stream.entries, fakeEntry{id: id, fields: args[1:]})
+	if maxLen >= 0 && len(stream.entries) > maxLen {
+		stream.entries = stream.entries[len(stream.entries)-maxLen:]
+	}
+	return id
+}
+
+func (s *FakeServer) xdel(args []string) interface{} {
+	stream, ok := s.streams[args[0]]
+	if !ok {
+		return int64(0)
+	}
+
+	var deleted int64
+	for _, id := range args[1:] {
+		for i, entry := range stream.entries {
+			if entry.id == id {
+				stream.entries = append(stream.entries[:i], stream.entries[i+1:]...)
+				deleted++
+				break
+			}
+		}
+	}
+	return deleted
+}
+
+func (s *FakeServer) xgroupCreate(args []string) interface{} {
+	key, group, start := args[1], args[2], args[3]
+	stream, ok := s.streams[key]
+	if !ok {
+		stream = &fakeStream{groups: map[string]*fakeGroup{}}
+		s.streams[key] = stream
+	}
+	if _, exists := stream.groups[group]; exists {
+		return fakeError("BUSYGROUP Consumer Group name already exists")
+	}
+
+	if start == "$" {
+		start = fmt.Sprintf("%d-0", s.lastSeq)
+	}
+	stream.groups[group] = &fakeGroup{lastID: start, pending: map[string]*fakePending{}}
+	return fakeStatus("OK")
+}
+
+func (s *FakeServer) xack(args []string) interface{} {
+	group, ok := s.group(args[0], args[1])
+	if !ok {
+		return int64(0)
+	}
+
+	var acked int64
+	for _, id := range args[2:] {
+		if _, pending := group.pending[id]; pending {
+			delete(group.pending, id)
+			acked++
+		}
+	}
+	return acked
+}
+
+// Pending returns the IDs of the entries pending in the group.
+func (s *FakeServer) Pending(key, group string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.group(key, group)
+	if !ok {
+		return nil
+	}
+	return sortedIDs(g.pending)
+}
+
+// xreadgroup reads a single stream, with the arguments in the order sent by
+// the package: GROUP group consumer COUNT n BLOCK ms STREAMS key id.
+func (s *FakeServer) xreadgroup(args []string) interface{} {
+	group, consumer := args[1], args[2]
+	count, _ := strconv.Atoi(args[4])
+	block, _ := strconv.Atoi(args[6])
+	key, id := args[8], args[9]
+
+	deadline := time.Now().Add(time.Duration(block) * time.Millisecond)
+	for {
+		s.mu.Lock()
+		reply, found := s.readGroup(key, group, consumer, id, count)
+		s.mu.Unlock()
+		if found || time.Now().After(deadline) {
+			return reply
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (s *FakeServer) readGroup(key, groupName, consumer, id string, count int) (interface{}, bool) {
+	group, ok := s.group(key, groupName)
+	if !ok {
+		return fakeError("NOGROUP No such consumer group"), true
+	}
+	stream := s.streams[key]
+
+	entries := []interface{}{}
+	if id == ">" {
+		for _, entry := range stream.entries {
+			if len(entries) == count {
+				break
+			} else if compareIDs(entry.id, group.lastID) <= 0 {
+				continue
+			}
+			group.lastID = entry.id
+			group.pending[entry.id] = &fakePending{consumer: consumer, deliveredAt: s.Now()}
+			entries = append(entries, stream.reply(entry.id))
+		}
+		if len(entries) == 0 {
+			return []interface{}(nil), false
+		}
+	} else {
+		for _, pendingID := range sortedIDs(group.pending) {
+			if len(entries) == count {
+				break
+			} else if group.pending[pendingID].consumer != consumer || compareIDs(pendingID, id) <= 0 {
+				continue
+			}
+			entries = append(entries, stream.reply(pendingID))
+		}
+	}
+	return []interface{}{[]interface{}{key, entries}}, true
+}
+
+// xautoclaim claims all the idle entries at once, replying as Redis 6.2.
+func (s *FakeServer) xautoclaim(args []string) interface{} {
+	key, consumer, start := args[0], args[2], args[4]
+	minIdle, _ := strconv.Atoi(args[3])
+	group, ok := s.group(key, args[1])
+	if !ok {
+		return fakeError("NOGROUP No such consumer group")
+	}
+
+	entries := []interface{}{}
+	for _, id := range sortedIDs(group.pending) {
+		pending := group.pending[id]
+		if compareIDs(id, start) < 0 || s.Now().Sub(pending.deliveredAt) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+		pending.consumer, pending.deliveredAt = consumer, s.Now()
+		entries = append(entries, s.streams[key].reply(id))
+	}
+	return []interface{}{"0-0", entries}
+}
+
+func (s *FakeServer) group(key, group string) (*fakeGroup, bool) {
+	stream, ok := s.streams[key]
+	if !ok {
+		return nil, false
+	}
+	g, ok := stream.groups[group]
+	return g, ok
+}
+
+// reply returns the entry as replied by reads, with nil fields if it was
+// deleted from the stream.
+func (st *fakeStream) reply(id string) interface{} {
+	for _, entry := range st.entries {
+		if entry.id == id {
+			fields := make([]interface{}, len(entry.fields))
+			for i, field := range entry.fields {
+				fields[i] = field
+			}
+			return []interface{}{id, fields}
+		}
+	}
+	return []interface{}{id, []interface{}(nil)}
+}
+
+func sortedIDs(pending map[string]*fakePending) []string {
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return compareIDs(ids[i], ids[j]) < 0
+	})
+	return ids
+}
+
+func compareIDs(a, b string) int {
+	aMs, aSeq := parseID(a)
+	bMs, bSeq := parseID(b)
+	switch {
+	case aMs != bMs:
+		return int(aMs - bMs)
+	default:
+		return int(aSeq - bSeq)
+	}
+}
+
+func parseID(id string) (int64, int64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msN, _ := strconv.ParseInt(ms, 10, 64)
+	seqN, _ := strconv.ParseInt(seq, 10, 64)
+	return msN, seqN
+}
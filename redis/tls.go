@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// TLSOptions describes a TLS configuration in terms of PEM files, as usually
+// provided by managed Redis offerings.
+type TLSOptions struct {
+	// CAFile has the certificates used to verify the server instead of the
+	// system ones.
+	CAFile string
+	// CertFile and KeyFile have the client certificate, for servers requiring
+	// mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name verified in the server certificate, which
+	// defaults to the host in the endpoint.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfig creates the TLS configuration to be set in RedisConfig.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read Redis CA file %s", opts.CAFile)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("No certificates found in Redis CA file %s", opts.CAFile)
+		}
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to load Redis client certificate %s", opts.CertFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	Convey("NewTLSConfig", t, func() {
+		dir := t.TempDir()
+		certFile, keyFile := writeTestCert(t, dir)
+		otherCertFile, _ := writeTestCert(t, filepath.Join(dir, "other"))
+		emptyFile := filepath.Join(dir, "empty.pem")
+		So(os.WriteFile(emptyFile, []byte("no certificates"), 0600), ShouldBeNil)
+		missingFile := filepath.Join(dir, "missing.pem")
+
+		cases := []struct {
+			name       string
+			opts       TLSOptions
+			err        string
+			rootCAs    bool
+			clientCert bool
+		}{
+			{name: "no files", opts: TLSOptions{ServerName: "redis", InsecureSkipVerify: true}},
+			{name: "CA file", opts: TLSOptions{CAFile: certFile}, rootCAs: true},
+			{name: "missing CA file", opts: TLSOptions{CAFile: missingFile}, err: "Failed to read Redis CA file"},
+			{name: "CA file without certificates", opts: TLSOptions{CAFile: emptyFile}, err: "No certificates found"},
+			{name: "client certificate", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile}, clientCert: true},
+			{name: "CA file and client certificate", opts: TLSOptions{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}, rootCAs: true, clientCert: true},
+			{name: "client certificate without key", opts: TLSOptions{CertFile: certFile}, err: "Failed to load Redis client certificate"},
+			{name: "client key without certificate", opts: TLSOptions{KeyFile: keyFile}, err: "Failed to load Redis client certificate"},
+			{name: "missing client certificate", opts: TLSOptions{CertFile: missingFile, KeyFile: keyFile}, err: "Failed to load Redis client certificate"},
+			{name: "client certificate not matching the key", opts: TLSOptions{CertFile: otherCertFile, KeyFile: keyFile}, err: "Failed to load Redis client certificate"},
+		}
+
+		for _, c := range cases {
+			Convey("It should handle "+c.name, func() {
+				config, err := NewTLSConfig(c.opts)
+				if c.err != "" {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, c.err)
+					So(config, ShouldBeNil)
+					return
+				}
+
+				So(err, ShouldBeNil)
+				So(config.ServerName, ShouldEqual, c.opts.ServerName)
+				So(config.InsecureSkipVerify, ShouldEqual, c.opts.InsecureSkipVerify)
+				So(config.RootCAs != nil, ShouldEqual, c.rootCAs)
+				So(len(config.Certificates) == 1, ShouldEqual, c.clientCert)
+			})
+		}
+	})
+}
+
+// writeTestCert writes a self-signed certificate and its key as PEM files in
+// dir, returning their paths.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,226 @@
+package reflext
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cacheKeyTag = "cachekey"
+	// Length of the hash in a cache key, in bytes of the SHA-256 sum.
+	cacheKeyHashSize = 16
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// CacheKey derives a stable cache key from v, prefixed by prefix. The value is
+// canonically encoded and hashed, so that values that are equal produce equal
+// keys regardless of e.g. map ordering or time zones, and different values are
+// practically guaranteed to produce different keys.
+//
+// All exported struct fields are part of the key, using the field name unless
+// renamed with a `cachekey:"name"` tag. Fields tagged with `cachekey:"-"` are
+// ignored. Structs without exported fields, such as big.Int, are encoded through
+// their encoding.TextMarshaler or fmt.Stringer implementation, and are not
+// supported if they have neither. Pointers are dereferenced and time.Time
+// values are compared as instants. Functions, channels and cyclic values are
+// not supported.
+func CacheKey(prefix string, v interface{}) (key string, err error) {
+	defer recoverError(&err)
+
+	enc := &cacheKeyEncoder{visiting: map[uintptr]bool{}}
+	if err := enc.encode(reflect.ValueOf(v)); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(enc.buf.Bytes())
+	return prefix + ":" + hex.EncodeToString(sum[:cacheKeyHashSize]), nil
+}
+
+// cacheKeyEncoder writes each value prefixed by a token identifying its kind
+// and, for variable length values, its length, so that the encoding of two
+// different values is never the same.
+type cacheKeyEncoder struct {
+	buf      bytes.Buffer
+	visiting map[uintptr]bool
+}
+
+func (e *cacheKeyEncoder) encode(rv reflect.Value) error {
+	if !rv.IsValid() {
+		e.buf.WriteByte('n')
+		return nil
+	}
+
+	if rv.Type() == timeType {
+		e.writeString('t', rv.Interface().(time.Time).UTC().Format(time.RFC3339Nano))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		e.writeString('b', strconv.FormatBool(rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeString('i', strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeString('u', strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		e.writeString('f', strconv.FormatFloat(rv.Float(), 'g', -1, 64))
+	case reflect.Complex64, reflect.Complex128:
+		e.writeString('c', strconv.FormatComplex(rv.Complex(), 'g', -1, 128))
+	case reflect.String:
+		e.writeString('s', rv.String())
+
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			e.buf.WriteByte('n')
+			return nil
+		}
+		if rv.Kind() == reflect.Ptr {
+			ptr := rv.Pointer()
+			if e.visiting[ptr] {
+				return errors.Errorf("Cannot derive cache key from cyclic value of type %s", rv.Type())
+			}
+			e.visiting[ptr] = true
+			defer delete(e.visiting, ptr)
+		}
+		return e.encode(rv.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeString('y', string(rv.Bytes()))
+			return nil
+		}
+		e.writeLen('[', rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.encode(rv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		return e.encodeMap(rv)
+
+	case reflect.Struct:
+		return e.encodeStruct(rv)
+
+	default:
+		return errors.Errorf("Cannot derive cache key from value of type %s", rv.Type())
+	}
+	return nil
+}
+
+func (e *cacheKeyEncoder) encodeMap(rv reflect.Value) error {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, rv.Len())
+	for _, key := range rv.MapKeys() {
+		keyEnc := &cacheKeyEncoder{visiting: e.visiting}
+		if err := keyEnc.encode(key); err != nil {
+			return err
+		}
+		entries = append(entries, entry{keyEnc.buf.Bytes(), rv.MapIndex(key)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	e.writeLen('{', len(entries))
+	for _, entry := range entries {
+		e.buf.Write(entry.key)
+		if err := e.encode(entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *cacheKeyEncoder) encodeStruct(rv reflect.Value) error {
+	type field struct {
+		name  string
+		index int
+	}
+
+	t := rv.Type()
+	fields := make([]field, 0, t.NumField())
+	exported := 0
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		exported++
+
+		name := sf.Tag.Get(cacheKeyTag)
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{name, i})
+	}
+	if exported == 0 && t.NumField() > 0 {
+		// All the state is hidden, so the fields can't tell values apart.
+		return e.encodeOpaque(rv)
+	}
+
+	// Sorting makes keys independent of the order in which fields are declared.
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+
+	e.writeLen('S', len(fields))
+	for _, f := range fields {
+		e.writeString('s', f.name)
+		if err := e.encode(rv.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *cacheKeyEncoder) encodeOpaque(rv reflect.Value) error {
+	// Methods are often declared on the pointer, as with big.Int.
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+
+	switch {
+	case ptr.Type().Implements(textMarshalerType):
+		text, err := ptr.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return errors.Wrapf(err, "Cannot derive cache key from value of type %s", rv.Type())
+		}
+		e.writeString('x', string(text))
+	case ptr.Type().Implements(stringerType):
+		e.writeString('x', ptr.Interface().(fmt.Stringer).String())
+	default:
+		return errors.Errorf("Cannot derive cache key from value of type %s without exported fields", rv.Type())
+	}
+	return nil
+}
+
+func (e *cacheKeyEncoder) writeString(token byte, s string) {
+	e.writeLen(token, len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *cacheKeyEncoder) writeLen(token byte, n int) {
+	e.buf.WriteByte(token)
+	e.buf.WriteString(strconv.Itoa(n))
+	e.buf.WriteByte(':')
+}
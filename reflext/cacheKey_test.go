@@ -0,0 +1,116 @@
+package reflext
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type cacheKeyParams struct {
+	Tenant  string
+	Account string `cachekey:"acc"`
+	Filters map[string]string
+	Since   *time.Time
+	Limit   int
+	Debug   bool `cachekey:"-"`
+	unused  string
+}
+
+func TestCacheKey(t *testing.T) {
+	Convey("CacheKey", t, func() {
+		since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		params := cacheKeyParams{
+			Tenant:  "tenant",
+			Account: "account",
+			Filters: map[string]string{"a": "1", "b": "2", "c": "3"},
+			Since:   &since,
+			Limit:   10,
+		}
+		key, err := CacheKey("search", params)
+		So(err, ShouldBeNil)
+
+		Convey("It should be prefixed and compact", func() {
+			So(key, ShouldStartWith, "search:")
+			So(len(key), ShouldEqual, len("search:")+2*cacheKeyHashSize)
+		})
+
+		Convey("It should be stable", func() {
+			other := params
+			other.Filters = map[string]string{"c": "3", "b": "2", "a": "1"}
+			otherKey, err := CacheKey("search", &other)
+			So(err, ShouldBeNil)
+			So(otherKey, ShouldEqual, key)
+		})
+
+		Convey("It should compare times as instants", func() {
+			other := params
+			inZone := since.In(time.FixedZone("BRT", -3*60*60))
+			other.Since = &inZone
+			otherKey, _ := CacheKey("search", other)
+			So(otherKey, ShouldEqual, key)
+		})
+
+		Convey("It should ignore fields tagged with -", func() {
+			other := params
+			other.Debug = true
+			otherKey, _ := CacheKey("search", other)
+			So(otherKey, ShouldEqual, key)
+		})
+
+		Convey("It should change with any other field", func() {
+			changes := []func(p *cacheKeyParams){
+				func(p *cacheKeyParams) { p.Tenant = "other" },
+				func(p *cacheKeyParams) { p.Account = "other" },
+				func(p *cacheKeyParams) { p.Filters = map[string]string{"a": "1"} },
+				func(p *cacheKeyParams) { p.Since = nil },
+				func(p *cacheKeyParams) { p.Limit = 11 },
+			}
+			for _, change := range changes {
+				other := params
+				change(&other)
+				otherKey, _ := CacheKey("search", other)
+				So(otherKey, ShouldNotEqual, key)
+			}
+
+			otherKey, _ := CacheKey("other", params)
+			So(otherKey, ShouldNotEqual, key)
+		})
+
+		Convey("It should not be ambiguous between values", func() {
+			k1, _ := CacheKey("p", []string{"ab", "c"})
+			k2, _ := CacheKey("p", []string{"a", "bc"})
+			So(k1, ShouldNotEqual, k2)
+
+			k1, _ = CacheKey("p", int64(1))
+			k2, _ = CacheKey("p", "1")
+			So(k1, ShouldNotEqual, k2)
+		})
+
+		Convey("It should encode structs without exported fields as text", func() {
+			k1, err := CacheKey("p", big.NewInt(1))
+			So(err, ShouldBeNil)
+			k2, _ := CacheKey("p", *big.NewInt(2))
+			So(k1, ShouldNotEqual, k2)
+
+			k2, _ = CacheKey("p", *big.NewInt(1))
+			So(k1, ShouldEqual, k2)
+		})
+
+		Convey("It should fail for unsupported values", func() {
+			_, err := CacheKey("p", struct{ F func() }{func() {}})
+			So(err, ShouldNotBeNil)
+
+			type opaque struct{ value int }
+			_, err = CacheKey("p", opaque{1})
+			So(err, ShouldNotBeNil)
+
+			type node struct{ Next *node }
+			cyclic := &node{}
+			cyclic.Next = cyclic
+			_, err = CacheKey("p", cyclic)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
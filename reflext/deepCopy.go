@@ -0,0 +1,287 @@
+package reflext
+
+import (
+	"math/big"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeepCopier may be implemented by types that need to control how they are
+// copied by DeepCopy. DeepCopy must return a value of the same type as the
+// receiver. Notice that a method with a pointer receiver is only used when
+// copying pointers to the type.
+type DeepCopier interface {
+	DeepCopy() interface{}
+}
+
+// UnexportedPolicy defines what DeepCopy does with unexported struct fields,
+// which cannot be copied deeply through reflection.
+type UnexportedPolicy int
+
+const (
+	// UnexportedShallow copies unexported fields as with a regular assignment,
+	// so any pointers, slices or maps in them are shared with the source.
+	UnexportedShallow UnexportedPolicy = iota
+	// UnexportedZero leaves unexported fields with their zero values.
+	UnexportedZero
+	// UnexportedError fails to copy structs with unexported fields.
+	UnexportedError
+)
+
+type DeepCopyOptions struct {
+	Unexported UnexportedPolicy
+}
+
+var (
+	deepCopierType = reflect.TypeOf((*DeepCopier)(nil)).Elem()
+
+	bigIntType   = reflect.TypeOf(&big.Int{})
+	bigFloatType = reflect.TypeOf(&big.Float{})
+	bigRatType   = reflect.TypeOf(&big.Rat{})
+
+	// immutableTypes are copied by assignment, regardless of their fields.
+	immutableTypes = map[reflect.Type]bool{
+		reflect.TypeOf(time.Time{}):      true,
+		reflect.TypeOf(&time.Location{}): true,
+		reflect.TypeOf(&regexp.Regexp{}): true,
+	}
+)
+
+// DeepCopy sets dst, which must be a non nil pointer, to an independent copy of
+// src, sharing no pointers, slices or maps with it. Values referenced more than
+// once in src, including cyclic references, are copied only once, so that they
+// are also shared in the copy. Functions and channels are copied by reference,
+// and the copy is set to dst as with SetPointer.
+func DeepCopy(dst, src interface{}) error {
+	return DeepCopyWithOptions(dst, src, DeepCopyOptions{})
+}
+
+func DeepCopyWithOptions(dst, src interface{}, opts DeepCopyOptions) (err error) {
+	defer recoverError(&err)
+
+	c := &copier{opts: opts, copied: map[copiedRef]reflect.Value{}}
+	copied, err := c.copy(reflect.ValueOf(src))
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if copied.IsValid() {
+		value = copied.Interface()
+	}
+	return SetPointer(dst, value)
+}
+
+// copiedRef identifies values with reference semantics that were already
+// copied. The type and length are needed since e.g. a pointer to a struct and
+// to its first field, or slices of different lengths, have the same address.
+type copiedRef struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type copier struct {
+	opts   DeepCopyOptions
+	copied map[copiedRef]reflect.Value
+}
+
+func (c *copier) copy(src reflect.Value) (reflect.Value, error) {
+	if !src.IsValid() {
+		return src, nil
+	}
+
+	t := src.Type()
+	if immutableTypes[t] {
+		return src, nil
+	}
+	if copied, ok, err := c.copyCustom(src); ok || err != nil {
+		return copied, err
+	}
+
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return src, nil
+		}
+		ref := copiedRef{src.Pointer(), t, 0}
+		if copied, ok := c.copied[ref]; ok {
+			return copied, nil
+		}
+
+		dst := reflect.New(t.Elem())
+		c.copied[ref] = dst
+		elem, err := c.copy(src.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		dst.Elem().Set(elem)
+		return dst, nil
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return src, nil
+		}
+		elem, err := c.copy(src.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		dst := reflect.New(t).Elem()
+		dst.Set(elem)
+		return dst, nil
+
+	case reflect.Map:
+		if src.IsNil() {
+			return src, nil
+		}
+		ref := copiedRef{src.Pointer(), t, 0}
+		if copied, ok := c.copied[ref]; ok {
+			return copied, nil
+		}
+
+		dst := reflect.MakeMapWithSize(t, src.Len())
+		c.copied[ref] = dst
+		iter := src.MapRange()
+		for iter.Next() {
+			value, err := c.copy(iter.Value())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			// Keys are comparable, so copying them would at most break the
+			// identity of pointer keys.
+			dst.SetMapIndex(iter.Key(), value)
+		}
+		return dst, nil
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return src, nil
+		}
+		ref := copiedRef{src.Pointer(), t, src.Len()}
+		if copied, ok := c.copied[ref]; ok {
+			return copied, nil
+		}
+
+		dst := reflect.MakeSlice(t, src.Len(), src.Cap())
+		c.copied[ref] = dst
+		return dst, c.copyElems(dst, src)
+
+	case reflect.Array:
+		dst := reflect.New(t).Elem()
+		return dst, c.copyElems(dst, src)
+
+	case reflect.Struct:
+		return c.copyStruct(src)
+
+	default:
+		// Basic types, functions and channels.
+		return src, nil
+	}
+}
+
+func (c *copier) copyElems(dst, src reflect.Value) error {
+	if !needsDeepCopy(src.Type().Elem()) {
+		reflect.Copy(dst, src)
+		return nil
+	}
+
+	for i := 0; i < src.Len(); i++ {
+		elem, err := c.copy(src.Index(i))
+		if err != nil {
+			return err
+		}
+		dst.Index(i).Set(elem)
+	}
+	return nil
+}
+
+func (c *copier) copyStruct(src reflect.Value) (reflect.Value, error) {
+	t := src.Type()
+	dst := reflect.New(t).Elem()
+	if c.opts.Unexported == UnexportedShallow {
+		dst.Set(src)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			if c.opts.Unexported == UnexportedError {
+				return reflect.Value{}, errors.Errorf("Cannot deep copy unexported field %s of %s", field.Name, t)
+			}
+			continue
+		}
+
+		value, err := c.copy(src.Field(i))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		dst.Field(i).Set(value)
+	}
+	return dst, nil
+}
+
+// copyCustom copies values implementing DeepCopier, as well as standard library
+// types with their own copy methods.
+func (c *copier) copyCustom(src reflect.Value) (reflect.Value, bool, error) {
+	t := src.Type()
+	if src.Kind() == reflect.Ptr && src.IsNil() {
+		return reflect.Value{}, false, nil
+	}
+	// Interfaces embedding DeepCopier are copied through their dynamic value,
+	// whose type is the one DeepCopy returns.
+	if t.Kind() == reflect.Interface {
+		return reflect.Value{}, false, nil
+	}
+
+	switch t {
+	case bigIntType:
+		return reflect.ValueOf(new(big.Int).Set(src.Interface().(*big.Int))), true, nil
+	case bigFloatType:
+		return reflect.ValueOf(new(big.Float).Copy(src.Interface().(*big.Float))), true, nil
+	case bigRatType:
+		return reflect.ValueOf(new(big.Rat).Set(src.Interface().(*big.Rat))), true, nil
+	}
+
+	if !t.Implements(deepCopierType) {
+		return reflect.Value{}, false, nil
+	}
+	// Pointers to types implementing DeepCopier by value are copied by
+	// dereferencing them, since the method would return the value type.
+	if t.Kind() == reflect.Ptr && t.Elem().Implements(deepCopierType) {
+		return reflect.Value{}, false, nil
+	}
+
+	copied := reflect.ValueOf(src.Interface().(DeepCopier).DeepCopy())
+	if !copied.IsValid() || copied.Type() != t {
+		return reflect.Value{}, false, errors.Errorf("DeepCopy of %s returned value of type %s", t, typeName(copied))
+	}
+	return copied, true, nil
+}
+
+// needsDeepCopy reports whether values of type t may reference memory that
+// would be shared by an assignment.
+func needsDeepCopy(t reflect.Type) bool {
+	if immutableTypes[t] {
+		return false
+	}
+	if t.Implements(deepCopierType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	case reflect.Array:
+		return needsDeepCopy(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" || needsDeepCopy(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
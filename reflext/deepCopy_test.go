@@ -0,0 +1,108 @@
+package reflext
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type deepCopyNode struct {
+	Name     string
+	Tags     []string
+	Attrs    map[string]interface{}
+	Next     *deepCopyNode
+	At       time.Time
+	Amount   *big.Int
+	Counters [2][]int
+	internal []string
+}
+
+type deepCopyCustom struct {
+	Values []int
+}
+
+func (c deepCopyCustom) DeepCopy() interface{} {
+	return deepCopyCustom{Values: []int{len(c.Values)}}
+}
+
+func TestDeepCopy(t *testing.T) {
+	Convey("DeepCopy", t, func() {
+		src := &deepCopyNode{
+			Name:     "root",
+			Tags:     []string{"a", "b"},
+			Attrs:    map[string]interface{}{"list": []interface{}{1, "x"}},
+			At:       time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Amount:   big.NewInt(42),
+			Counters: [2][]int{{1}, {2}},
+			internal: []string{"i"},
+		}
+
+		Convey("It should copy values without sharing memory", func() {
+			var dst *deepCopyNode
+			So(DeepCopy(&dst, src), ShouldBeNil)
+			So(dst, ShouldResemble, src)
+			So(dst, ShouldNotPointTo, src)
+
+			dst.Tags[0] = "mutated"
+			dst.Attrs["list"].([]interface{})[0] = 2
+			dst.Amount.SetInt64(0)
+			dst.Counters[0][0] = 0
+			So(src.Tags[0], ShouldEqual, "a")
+			So(src.Attrs["list"].([]interface{})[0], ShouldEqual, 1)
+			So(src.Amount.Int64(), ShouldEqual, 42)
+			So(src.Counters[0][0], ShouldEqual, 1)
+		})
+
+		Convey("It should copy into values and interfaces", func() {
+			var value deepCopyNode
+			So(DeepCopy(&value, src), ShouldBeNil)
+			So(value.Name, ShouldEqual, "root")
+
+			var iface interface{}
+			So(DeepCopy(&iface, *src), ShouldBeNil)
+			So(iface.(deepCopyNode).Tags, ShouldResemble, src.Tags)
+		})
+
+		Convey("It should preserve cycles and shared references", func() {
+			src.Next = src
+			var dst *deepCopyNode
+			So(DeepCopy(&dst, src), ShouldBeNil)
+			So(dst.Next, ShouldPointTo, dst)
+			So(dst.Next, ShouldNotPointTo, src)
+		})
+
+		Convey("It should apply the unexported fields policy", func() {
+			var dst *deepCopyNode
+			So(DeepCopy(&dst, src), ShouldBeNil)
+			So(dst.internal, ShouldResemble, src.internal)
+
+			opts := DeepCopyOptions{Unexported: UnexportedZero}
+			So(DeepCopyWithOptions(&dst, src, opts), ShouldBeNil)
+			So(dst.internal, ShouldBeNil)
+			So(dst.At.Equal(src.At), ShouldBeTrue)
+
+			opts = DeepCopyOptions{Unexported: UnexportedError}
+			So(DeepCopyWithOptions(&dst, src, opts), ShouldNotBeNil)
+		})
+
+		Convey("It should use DeepCopier implementations", func() {
+			var dst []deepCopyCustom
+			So(DeepCopy(&dst, []deepCopyCustom{{Values: []int{1, 2, 3}}}), ShouldBeNil)
+			So(dst, ShouldResemble, []deepCopyCustom{{Values: []int{3}}})
+		})
+
+		Convey("It should use DeepCopier implementations held in DeepCopier interfaces", func() {
+			var dst []DeepCopier
+			So(DeepCopy(&dst, []DeepCopier{deepCopyCustom{Values: []int{1, 2}}, nil}), ShouldBeNil)
+			So(dst, ShouldResemble, []DeepCopier{deepCopyCustom{Values: []int{2}}, nil})
+		})
+
+		Convey("It should copy nil values", func() {
+			dst := &deepCopyNode{}
+			So(DeepCopy(&dst, nil), ShouldBeNil)
+			So(dst, ShouldBeNil)
+		})
+	})
+}
@@ -1,34 +1,175 @@
 package reflext
 
 import (
+	"encoding/json"
+	"math"
 	"reflect"
 
 	"github.com/pkg/errors"
 )
 
-func SetPointer(dstPtr, srcValue interface{}) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			switch rerr := r.(type) {
-			case error:
-				err = rerr
-			case string:
-				err = errors.New(rerr)
-			default:
-				err = errors.Errorf("Panic in reflective code: %s", rerr)
-			}
-		}
-	}()
+type SetPointerOptions struct {
+	// JSONFallback makes SetPointer encode the value as JSON and decode it into
+	// the pointer when the types are otherwise incompatible, e.g. to set a
+	// map[string]interface{} to a struct pointer.
+	JSONFallback bool
+}
+
+// SetPointer sets the value pointed to by dstPtr to srcValue. Besides values of
+// assignable types (including any value to an interface), it supports:
+//   - dereferencing srcValue, e.g. setting a *T to a T;
+//   - taking the address of srcValue, e.g. setting a T to a *T;
+//   - converting between numeric types, as long as no precision is lost;
+//   - converting between named types with the same underlying type.
+func SetPointer(dstPtr, srcValue interface{}) error {
+	return SetPointerWithOptions(dstPtr, srcValue, SetPointerOptions{})
+}
+
+func SetPointerWithOptions(dstPtr, srcValue interface{}, opts SetPointerOptions) (err error) {
+	defer recoverError(&err)
 
 	dstPtrRv := reflect.ValueOf(dstPtr)
-	if dstPtrRv.Kind() != reflect.Ptr {
-		return errors.New("Value and result must have the same type")
+	if dstPtrRv.Kind() != reflect.Ptr || dstPtrRv.IsNil() {
+		return errors.Errorf("Result must be a non nil pointer, got %T", dstPtr)
+	}
+
+	dst, src := dstPtrRv.Elem(), reflect.ValueOf(srcValue)
+	ok, err := setValue(dst, src)
+	if ok || err != nil {
+		return err
+	}
+
+	if opts.JSONFallback {
+		data, err := json.Marshal(srcValue)
+		if err == nil {
+			err = json.Unmarshal(data, dstPtr)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to convert value of type %s to %s through JSON", typeName(src), dst.Type())
+		}
+		return nil
+	}
+	return errors.Errorf("Cannot set value of type %s to pointer of type %s", typeName(src), dstPtrRv.Type())
+}
+
+// setValue tries each of the supported ways of setting src to dst, only
+// modifying dst when one of them succeeds.
+func setValue(dst, src reflect.Value) (bool, error) {
+	dstType := dst.Type()
+	if !src.IsValid() {
+		if !isNillable(dstType.Kind()) {
+			return false, nil
+		}
+		dst.Set(reflect.Zero(dstType))
+		return true, nil
+	}
+
+	srcType := src.Type()
+	if srcType.AssignableTo(dstType) {
+		dst.Set(src)
+		return true, nil
+	}
+
+	if ok, err := convertValue(dst, src); ok || err != nil {
+		return ok, err
+	}
+
+	if (src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface) && !src.IsNil() {
+		if ok, err := setValue(dst, src.Elem()); ok || err != nil {
+			return ok, err
+		}
+	}
+
+	if dstType.Kind() == reflect.Ptr {
+		ptr := reflect.New(dstType.Elem())
+		if ok, err := setValue(ptr.Elem(), src); !ok || err != nil {
+			return ok, err
+		}
+		dst.Set(ptr)
+		return true, nil
 	}
+	return false, nil
+}
+
+func convertValue(dst, src reflect.Value) (bool, error) {
+	srcType, dstType := src.Type(), dst.Type()
+
+	if isNumeric(srcType.Kind()) && isNumeric(dstType.Kind()) {
+		converted := src.Convert(dstType)
+		if isNaN(src) && isNaN(converted) {
+			// NaN is never equal to itself, but converting it between floats
+			// loses nothing.
+			dst.Set(converted)
+			return true, nil
+		}
+		if sign(converted) != sign(src) || !converted.Convert(srcType).Equal(src) {
+			return false, errors.Errorf("Cannot convert %v of type %s to %s without loss", src, srcType, dstType)
+		}
+		dst.Set(converted)
+		return true, nil
+	}
+
+	// Restricting conversions to the same kind leaves out e.g. int to string.
+	if srcType.Kind() == dstType.Kind() && srcType.ConvertibleTo(dstType) {
+		dst.Set(src.Convert(dstType))
+		return true, nil
+	}
+	return false, nil
+}
+
+func isNumeric(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+func isNaN(rv reflect.Value) bool {
+	return rv.CanFloat() && math.IsNaN(rv.Float())
+}
 
-	valueRv := reflect.ValueOf(srcValue)
-	if dstPtrRv.Elem().Type() != valueRv.Type() {
-		return errors.New("Value and pointer incompatible types")
+func isNillable(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return true
+	}
+	return false
+}
+
+func sign(rv reflect.Value) int {
+	var f float64
+	switch {
+	case rv.CanInt():
+		f = float64(rv.Int())
+	case rv.CanUint():
+		f = float64(rv.Uint())
+	default:
+		f = rv.Float()
+	}
+
+	if f < 0 {
+		return -1
+	} else if f > 0 {
+		return 1
+	}
+	return 0
+}
+
+func typeName(rv reflect.Value) string {
+	if !rv.IsValid() {
+		return "nil"
+	}
+	return rv.Type().String()
+}
+
+// recoverError must be deferred directly by functions with reflective code,
+// converting any panic to an error returned through errPtr.
+func recoverError(errPtr *error) {
+	if r := recover(); r != nil {
+		switch rerr := r.(type) {
+		case error:
+			*errPtr = rerr
+		case string:
+			*errPtr = errors.New(rerr)
+		default:
+			*errPtr = errors.Errorf("Panic in reflective code: %s", rerr)
+		}
 	}
-	dstPtrRv.Elem().Set(valueRv)
-	return nil
 }
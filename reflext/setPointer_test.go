@@ -0,0 +1,122 @@
+package reflext
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type setPointerID string
+
+type setPointerIDs []setPointerID
+
+type setPointerIDList []setPointerID
+
+type setPointerItem struct {
+	Name  string
+	Count int
+}
+
+func TestSetPointer(t *testing.T) {
+	Convey("SetPointer", t, func() {
+		Convey("It should set values of the same type", func() {
+			var result setPointerItem
+			So(SetPointer(&result, setPointerItem{"a", 1}), ShouldBeNil)
+			So(result, ShouldResemble, setPointerItem{"a", 1})
+		})
+
+		Convey("It should set values to interfaces", func() {
+			var result interface{}
+			So(SetPointer(&result, setPointerItem{"a", 1}), ShouldBeNil)
+			So(result, ShouldResemble, setPointerItem{"a", 1})
+		})
+
+		Convey("It should set nil to nillable types", func() {
+			result := &setPointerItem{}
+			So(SetPointer(&result, nil), ShouldBeNil)
+			So(result, ShouldBeNil)
+
+			var value int
+			So(SetPointer(&value, nil), ShouldNotBeNil)
+		})
+
+		Convey("It should dereference pointers", func() {
+			var result setPointerItem
+			So(SetPointer(&result, &setPointerItem{"a", 1}), ShouldBeNil)
+			So(result, ShouldResemble, setPointerItem{"a", 1})
+		})
+
+		Convey("It should take the address of values", func() {
+			var result *setPointerItem
+			So(SetPointer(&result, setPointerItem{"a", 1}), ShouldBeNil)
+			So(result, ShouldResemble, &setPointerItem{"a", 1})
+
+			var resultPtr **setPointerItem
+			So(SetPointer(&resultPtr, &setPointerItem{"b", 2}), ShouldBeNil)
+			So(**resultPtr, ShouldResemble, setPointerItem{"b", 2})
+		})
+
+		Convey("It should convert named types", func() {
+			var id setPointerID
+			So(SetPointer(&id, "abc"), ShouldBeNil)
+			So(id, ShouldEqual, setPointerID("abc"))
+
+			// Named slices are not assignable to each other.
+			var ids setPointerIDList
+			So(SetPointer(&ids, setPointerIDs{"a"}), ShouldBeNil)
+			So(ids, ShouldResemble, setPointerIDList{"a"})
+
+			// Only the slice itself is converted, not its elements.
+			var fromStrings []setPointerID
+			So(SetPointer(&fromStrings, []string{"a"}), ShouldNotBeNil)
+			So(fromStrings, ShouldBeNil)
+		})
+
+		Convey("It should convert numbers without loss", func() {
+			var count int
+			So(SetPointer(&count, float64(10)), ShouldBeNil)
+			So(count, ShouldEqual, 10)
+
+			So(SetPointer(&count, 10.5), ShouldNotBeNil)
+
+			var unsigned uint8
+			So(SetPointer(&unsigned, -1), ShouldNotBeNil)
+			So(SetPointer(&unsigned, 256), ShouldNotBeNil)
+			So(unsigned, ShouldEqual, 0)
+		})
+
+		Convey("It should convert NaN between floats", func() {
+			var single float32
+			So(SetPointer(&single, math.NaN()), ShouldBeNil)
+			So(math.IsNaN(float64(single)), ShouldBeTrue)
+
+			var count int
+			So(SetPointer(&count, math.NaN()), ShouldNotBeNil)
+		})
+
+		Convey("It should not convert numbers to strings", func() {
+			var s string
+			err := SetPointer(&s, 65)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "int")
+			So(err.Error(), ShouldContainSubstring, "*string")
+		})
+
+		Convey("It should require a non nil pointer", func() {
+			So(SetPointer(setPointerItem{}, setPointerItem{}), ShouldNotBeNil)
+			So(SetPointer((*setPointerItem)(nil), setPointerItem{}), ShouldNotBeNil)
+		})
+
+		Convey("It should optionally convert through JSON", func() {
+			src := map[string]interface{}{"Name": "a", "Count": 1}
+
+			var result setPointerItem
+			So(SetPointer(&result, src), ShouldNotBeNil)
+
+			opts := SetPointerOptions{JSONFallback: true}
+			So(SetPointerWithOptions(&result, src, opts), ShouldBeNil)
+			So(result, ShouldResemble, setPointerItem{"a", 1})
+		})
+	})
+}
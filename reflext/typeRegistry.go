@@ -0,0 +1,83 @@
+package reflext
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TypeRegistry maps names to Go types, so that values can be serialized together
+// with the name of their concrete type and later decoded back into it, even when
+// the destination is an interface (see Marshal and Unmarshal).
+type TypeRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		byName: map[string]reflect.Type{},
+		byType: map[reflect.Type]string{},
+	}
+}
+
+// DefaultTypes is a registry shared by the whole program, to which packages may
+// register their types on init.
+var DefaultTypes = NewTypeRegistry()
+
+// RegisterType registers the type of sample in DefaultTypes.
+func RegisterType(name string, sample interface{}) error {
+	return DefaultTypes.Register(name, sample)
+}
+
+// Register registers the type of sample with the given name. Registering the
+// same type with the same name again is a no-op, while reusing a name or type
+// is an error. Notice that T and *T are different types and must be registered
+// separately if both are used.
+func (r *TypeRegistry) Register(name string, sample interface{}) error {
+	if name == "" {
+		return errors.New("Type name must not be empty")
+	}
+	if sample == nil {
+		return errors.Errorf("Cannot register nil sample for type %s", name)
+	}
+	t := reflect.TypeOf(sample)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.byName[name]; ok {
+		if existing == t {
+			return nil
+		}
+		return errors.Errorf("Type name %s already registered for %s", name, existing)
+	}
+	if existing, ok := r.byType[t]; ok {
+		return errors.Errorf("Type %s already registered as %s", t, existing)
+	}
+	r.byName[name] = t
+	r.byType[t] = name
+	return nil
+}
+
+// TypeByName returns the type registered with the given name.
+func (r *TypeRegistry) TypeByName(name string) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+// NameOf returns the name with which the type of v was registered.
+func (r *TypeRegistry) NameOf(v interface{}) (string, bool) {
+	return r.nameOfType(reflect.TypeOf(v))
+}
+
+func (r *TypeRegistry) nameOfType(t reflect.Type) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.byType[t]
+	return name, ok
+}
@@ -0,0 +1,597 @@
+package reflext
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// typedEnvelope is how values in interface-typed positions are encoded, so that
+// their concrete type can be recovered when decoding.
+type typedEnvelope struct {
+	Type  string          `json:"$type"`
+	Value json.RawMessage `json:"$value"`
+}
+
+var (
+	emptyInterfaceType  = reflect.TypeOf((*interface{})(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// containsInterfaceCache memoizes containsInterface, indexed by reflect.Type.
+	containsInterfaceCache sync.Map
+	// jsonFieldsCache memoizes jsonFields, indexed by reflect.Type.
+	jsonFieldsCache sync.Map
+)
+
+// Marshal encodes v as JSON, recording the registered name of the concrete type
+// of v and of every value held in an interface-typed position (e.g. the items
+// of a []Shape), so that Unmarshal can decode them back to their original Go
+// types. Values of types containing no interfaces are encoded by encoding/json,
+// and the fields of other structs follow its rules (tags, embedding and the
+// string option).
+//
+// All concrete types held in interfaces must have been registered, while the
+// type of v itself only needs to be registered for decoding into an interface.
+func (r *TypeRegistry) Marshal(v interface{}) (data []byte, err error) {
+	defer recoverError(&err)
+
+	rv := reflect.ValueOf(v)
+	static := emptyInterfaceType
+	if rv.IsValid() {
+		if _, registered := r.nameOfType(rv.Type()); !registered {
+			// Only record the top level type when it is registered, so that
+			// e.g. a []Shape can be encoded without registering its slice type.
+			static = rv.Type()
+		}
+	}
+
+	tree, err := r.toTree(rv, static)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// Unmarshal decodes data encoded with Marshal into result, which must be a non
+// nil pointer. Interface-typed positions, including result itself, are filled
+// with values of the recorded concrete types.
+func (r *TypeRegistry) Unmarshal(data []byte, result interface{}) (err error) {
+	defer recoverError(&err)
+
+	resultRv := reflect.ValueOf(result)
+	if resultRv.Kind() != reflect.Ptr || resultRv.IsNil() {
+		return errors.Errorf("Result must be a non nil pointer, got %T", result)
+	}
+
+	target := resultRv.Elem()
+	if target.Kind() != reflect.Interface && r.isEnvelopeFor(data, target.Type()) {
+		// The top level value is enveloped if its type is registered, but the
+		// caller already knows the type it wants.
+		var envelope typedEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return errors.Wrap(err, "Failed to decode typed value")
+		}
+		return r.fromTree(envelope.Value, target)
+	}
+	return r.fromTree(data, target)
+}
+
+// isEnvelopeFor returns whether data is the envelope Marshal writes for a top
+// level value of a registered type that decodes into t, i.e. t itself or a
+// pointer to or from it. Other objects, even if they have a "$type" field, are
+// values of t.
+func (r *TypeRegistry) isEnvelopeFor(data []byte, t reflect.Type) bool {
+	var envelope typedEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Type == "" {
+		return false
+	}
+	concrete, ok := r.TypeByName(envelope.Type)
+	if !ok {
+		return false
+	}
+	return concrete == t || concrete == reflect.PtrTo(t) ||
+		(t.Kind() == reflect.Ptr && concrete == t.Elem())
+}
+
+func (r *TypeRegistry) toTree(rv reflect.Value, static reflect.Type) (interface{}, error) {
+	if static.Kind() == reflect.Interface {
+		if rv.Kind() == reflect.Interface {
+			rv = rv.Elem()
+		}
+		if !rv.IsValid() {
+			return nil, nil
+		}
+
+		name, ok := r.nameOfType(rv.Type())
+		if !ok {
+			return nil, errors.Errorf("Type %s is not registered", rv.Type())
+		}
+		value, err := r.toTree(rv, rv.Type())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"$type": name, "$value": value}, nil
+	}
+
+	if !containsInterface(static) || isJSONLeaf(static) {
+		bytes, err := json.Marshal(rv.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(bytes), nil
+	}
+
+	switch static.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return r.toTree(rv.Elem(), static.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if static.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			item, err := r.toTree(rv.Index(i), static.Elem())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		items := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keyStr, err := mapKeyString(key)
+			if err != nil {
+				return nil, err
+			}
+			item, err := r.toTree(rv.MapIndex(key), static.Elem())
+			if err != nil {
+				return nil, err
+			}
+			items[keyStr] = item
+		}
+		return items, nil
+
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for _, f := range jsonFields(static) {
+			fieldRv, ok := fieldByIndex(rv, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fieldRv)) {
+				continue
+			}
+			field, err := r.toTree(fieldRv, f.typ)
+			if err != nil {
+				return nil, err
+			}
+			if f.quoted {
+				// Quoted fields are scalars, so they were encoded by encoding/json.
+				if field, err = quoteJSON(field.(json.RawMessage)); err != nil {
+					return nil, err
+				}
+			}
+			fields[f.name] = field
+		}
+		return fields, nil
+	}
+	return nil, errors.Errorf("Unsupported type for typed encoding: %s", static)
+}
+
+func (r *TypeRegistry) fromTree(data json.RawMessage, target reflect.Value) error {
+	t := target.Type()
+	if !containsInterface(t) || isJSONLeaf(t) {
+		return json.Unmarshal(data, target.Addr().Interface())
+	}
+
+	if isJSONNull(data) {
+		target.Set(reflect.Zero(t))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		var envelope typedEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return errors.Wrap(err, "Failed to decode typed value")
+		}
+		concrete, ok := r.TypeByName(envelope.Type)
+		if !ok {
+			return errors.Errorf("Type name %q is not registered", envelope.Type)
+		}
+		if !concrete.AssignableTo(t) {
+			return errors.Errorf("Type %s (%s) cannot be assigned to %s", concrete, envelope.Type, t)
+		}
+		value := reflect.New(concrete).Elem()
+		if err := r.fromTree(envelope.Value, value); err != nil {
+			return err
+		}
+		target.Set(value)
+		return nil
+
+	case reflect.Ptr:
+		if target.IsNil() {
+			target.Set(reflect.New(t.Elem()))
+		}
+		return r.fromTree(data, target.Elem())
+
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		if t.Kind() == reflect.Slice {
+			target.Set(reflect.MakeSlice(t, len(items), len(items)))
+		}
+		for i := 0; i < len(items) && i < target.Len(); i++ {
+			if err := r.fromTree(items[i], target.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(t, len(items))
+		for keyStr, itemData := range items {
+			key, err := parseMapKey(keyStr, t.Key())
+			if err != nil {
+				return err
+			}
+			item := reflect.New(t.Elem()).Elem()
+			if err := r.fromTree(itemData, item); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, item)
+		}
+		target.Set(m)
+		return nil
+
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		for _, f := range jsonFields(t) {
+			fieldData, ok := fields[f.name]
+			if !ok {
+				fieldData, ok = findFoldedField(fields, f.name)
+			}
+			if !ok {
+				continue
+			}
+			if f.quoted && !isJSONNull(fieldData) {
+				var unquoted string
+				if err := json.Unmarshal(fieldData, &unquoted); err != nil {
+					return errors.Wrapf(err, "Failed to decode quoted field %s", f.name)
+				}
+				fieldData = json.RawMessage(unquoted)
+			}
+			fieldRv, err := settableFieldByIndex(target, f.index)
+			if err != nil {
+				return err
+			}
+			if err := r.fromTree(fieldData, fieldRv); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("Unsupported type for typed decoding: %s", t)
+}
+
+// containsInterface returns whether values of type t can hold interfaces
+// anywhere within them, which is when they need to be walked for encoding.
+func containsInterface(t reflect.Type) bool {
+	if cached, ok := containsInterfaceCache.Load(t); ok {
+		return cached.(bool)
+	}
+	result := containsInterfaceRec(t, map[reflect.Type]bool{})
+	containsInterfaceCache.Store(t, result)
+	return result
+}
+
+func containsInterfaceRec(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return containsInterfaceRec(t.Elem(), visiting)
+	case reflect.Map:
+		return containsInterfaceRec(t.Elem(), visiting)
+	case reflect.Struct:
+		for _, f := range jsonFields(t) {
+			if containsInterfaceRec(f.typ, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isJSONLeaf returns whether t has its own JSON encoding, in which case it's
+// always handled by encoding/json.
+func isJSONLeaf(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface {
+		return false
+	}
+	ptr := reflect.PtrTo(t)
+	return t.Implements(jsonMarshalerType) || ptr.Implements(jsonUnmarshalerType) ||
+		t.Implements(textMarshalerType) || ptr.Implements(textUnmarshalerType)
+}
+
+type jsonField struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+// jsonFields lists the fields of a struct type as encoding/json would see them:
+// the fields of embedded structs (or pointers to structs) without a name tag are
+// promoted, and among fields with the same name the shallowest one wins,
+// preferring tagged ones, while ties leave the name out entirely.
+func jsonFields(t reflect.Type) []jsonField {
+	if cached, ok := jsonFieldsCache.Load(t); ok {
+		return cached.([]jsonField)
+	}
+
+	var candidates []jsonField
+	visited := map[reflect.Type]bool{}
+	next := []jsonField{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, embedding := range current {
+			// Fields of a type already seen at a shallower depth would lose,
+			// while the same type twice at a depth makes its fields ambiguous.
+			if !visited[embedding.typ] {
+				candidates = append(candidates, structFields(embedding, &next)...)
+			}
+		}
+		for _, embedding := range current {
+			visited[embedding.typ] = true
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].name != candidates[j].name {
+			return candidates[i].name < candidates[j].name
+		}
+		if len(candidates[i].index) != len(candidates[j].index) {
+			return len(candidates[i].index) < len(candidates[j].index)
+		}
+		return candidates[i].tagged && !candidates[j].tagged
+	})
+
+	fields := []jsonField{}
+	for i := 0; i < len(candidates); {
+		j := i + 1
+		for j < len(candidates) && candidates[j].name == candidates[i].name {
+			j++
+		}
+		if dominant, ok := dominantField(candidates[i:j]); ok {
+			fields = append(fields, dominant)
+		}
+		i = j
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return lessIndex(fields[i].index, fields[j].index)
+	})
+
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
+
+// structFields returns the direct fields of the struct type of embedding, adding
+// the embedded structs whose fields are promoted to next.
+func structFields(embedding jsonField, next *[]jsonField) []jsonField {
+	var fields []jsonField
+	t := embedding.typ
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx:]
+		}
+
+		ft := sf.Type
+		if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous {
+			if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+				// unexported non struct
+				continue
+			}
+		} else if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		index := append(append([]int{}, embedding.index...), i)
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			*next = append(*next, jsonField{index: index, typ: ft})
+			continue
+		}
+
+		field := jsonField{
+			name:      name,
+			index:     index,
+			typ:       sf.Type,
+			tagged:    name != "",
+			omitEmpty: strings.Contains(opts, ",omitempty"),
+		}
+		if field.name == "" {
+			field.name = sf.Name
+		}
+		if strings.Contains(opts, ",string") {
+			switch ft.Kind() {
+			case reflect.Bool, reflect.String,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+				reflect.Float32, reflect.Float64:
+				field.quoted = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// dominantField picks the field encoding/json uses among fields with the same
+// name, sorted by depth and then by whether they are tagged.
+func dominantField(fields []jsonField) (jsonField, bool) {
+	if len(fields) > 1 && len(fields[0].index) == len(fields[1].index) &&
+		fields[0].tagged == fields[1].tagged {
+		return jsonField{}, false
+	}
+	return fields[0], true
+}
+
+func lessIndex(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but reports false instead of
+// panicking when going through a nil embedded pointer.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, fieldIndex := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(fieldIndex)
+	}
+	return rv, true
+}
+
+// settableFieldByIndex is like reflect.Value.FieldByIndex, but allocates nil
+// embedded pointers along the way.
+func settableFieldByIndex(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, fieldIndex := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Value{}, errors.Errorf("Cannot set embedded pointer to unexported struct %s", rv.Type().Elem())
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(fieldIndex)
+	}
+	return rv, nil
+}
+
+// quoteJSON encodes data as a JSON string, as done for fields with the string
+// option of encoding/json.
+func quoteJSON(data json.RawMessage) (json.RawMessage, error) {
+	if isJSONNull(data) {
+		return data, nil
+	}
+	return json.Marshal(string(data))
+}
+
+func findFoldedField(fields map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	for key, data := range fields {
+		if strings.EqualFold(key, name) {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+func mapKeyString(key reflect.Value) (string, error) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", errors.Errorf("Unsupported map key type for typed encoding: %s", key.Type())
+}
+
+func parseMapKey(keyStr string, keyType reflect.Type) (reflect.Value, error) {
+	key := reflect.New(keyType).Elem()
+	switch keyType.Kind() {
+	case reflect.String:
+		key.SetString(keyStr)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(keyStr, 10, keyType.Bits())
+		if err != nil {
+			return key, err
+		}
+		key.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(keyStr, 10, keyType.Bits())
+		if err != nil {
+			return key, err
+		}
+		key.SetUint(n)
+	default:
+		return key, errors.Errorf("Unsupported map key type for typed decoding: %s", keyType)
+	}
+	return key, nil
+}
+
+func isJSONNull(data json.RawMessage) bool {
+	return strings.TrimSpace(string(data)) == "null"
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
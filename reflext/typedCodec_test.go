@@ -0,0 +1,174 @@
+package reflext
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type square struct {
+	Side float64
+}
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+type circle struct {
+	Radius float64 `json:"r"`
+}
+
+func (c *circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type drawing struct {
+	Name    string
+	Shapes  []shape
+	ByName  map[string]shape `json:"byName,omitempty"`
+	Created time.Time
+	Extra   interface{}
+	Ignored shape `json:"-"`
+}
+
+type TypedBase struct {
+	ID   int `json:",string"`
+	Name string
+}
+
+type typedOther struct {
+	Name string
+}
+
+type typedRecord struct {
+	*TypedBase
+	typedOther
+	Count int64 `json:"count,string"`
+	Shape shape
+}
+
+type linkedData struct {
+	Type string `json:"$type"`
+	Name string
+}
+
+func TestTypedCodec(t *testing.T) {
+	registry := NewTypeRegistry()
+
+	Convey("TypeRegistry", t, func() {
+		So(registry.Register("square", square{}), ShouldBeNil)
+		So(registry.Register("circle", &circle{}), ShouldBeNil)
+		So(registry.Register("drawing", drawing{}), ShouldBeNil)
+
+		Convey("It should allow registering the same type again", func() {
+			So(registry.Register("square", square{}), ShouldBeNil)
+		})
+
+		Convey("It should reject reusing names or types", func() {
+			So(registry.Register("square", circle{}), ShouldNotBeNil)
+			So(registry.Register("other_square", square{}), ShouldNotBeNil)
+		})
+
+		Convey("It should look up types and names", func() {
+			name, ok := registry.NameOf(&circle{})
+			So(ok, ShouldBeTrue)
+			So(name, ShouldEqual, "circle")
+
+			_, ok = registry.NameOf(circle{})
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("It should decode interface values to their original types", func() {
+			original := drawing{
+				Name:    "test",
+				Shapes:  []shape{square{2}, &circle{1}, nil},
+				ByName:  map[string]shape{"sq": square{3}},
+				Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				Extra:   square{4},
+				Ignored: square{5},
+			}
+			data, err := registry.Marshal(original)
+			So(err, ShouldBeNil)
+
+			var decoded drawing
+			So(registry.Unmarshal(data, &decoded), ShouldBeNil)
+			original.Ignored = nil
+			So(decoded, ShouldResemble, original)
+
+			var asInterface interface{}
+			So(registry.Unmarshal(data, &asInterface), ShouldBeNil)
+			So(asInterface, ShouldResemble, original)
+		})
+
+		Convey("It should encode values without interfaces as plain JSON", func() {
+			data, err := registry.Marshal(square{2})
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `{"$type":"square","$value":{"Side":2}}`)
+
+			var decoded square
+			So(registry.Unmarshal([]byte(`{"Side":2}`), &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, square{2})
+		})
+
+		Convey("It should follow the field rules of encoding/json", func() {
+			record := typedRecord{
+				TypedBase:  &TypedBase{ID: 1, Name: "base"},
+				typedOther: typedOther{Name: "other"},
+				Count:      2,
+			}
+			data, err := registry.Marshal(record)
+			So(err, ShouldBeNil)
+			expected, _ := json.Marshal(record)
+
+			var fields, expectedFields map[string]interface{}
+			So(json.Unmarshal(data, &fields), ShouldBeNil)
+			So(json.Unmarshal(expected, &expectedFields), ShouldBeNil)
+			So(fields, ShouldResemble, expectedFields)
+
+			record = typedRecord{TypedBase: &TypedBase{ID: 1}, Count: 2, Shape: square{2}}
+			data, err = registry.Marshal(record)
+			So(err, ShouldBeNil)
+
+			var decoded typedRecord
+			So(registry.Unmarshal(data, &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+
+			data, err = registry.Marshal(typedRecord{})
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `{"Shape":null,"count":"0"}`)
+		})
+
+		Convey("It should only unwrap envelopes of the type being decoded", func() {
+			var decoded linkedData
+			So(registry.Unmarshal([]byte(`{"$type":"square","Name":"x"}`), &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, linkedData{Type: "square", Name: "x"})
+
+			var sq *square
+			So(registry.Unmarshal([]byte(`{"$type":"square","$value":{"Side":2}}`), &sq), ShouldBeNil)
+			So(sq, ShouldResemble, &square{2})
+		})
+
+		Convey("It should not require registering the top level type", func() {
+			data, err := registry.Marshal([]shape{&circle{1}})
+			So(err, ShouldBeNil)
+
+			var decoded []shape
+			So(registry.Unmarshal(data, &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, []shape{&circle{1}})
+		})
+
+		Convey("It should fail for unregistered types in interfaces", func() {
+			_, err := registry.Marshal([]shape{unregistered{}})
+			So(err, ShouldNotBeNil)
+
+			var decoded []shape
+			So(registry.Unmarshal([]byte(`[{"$type":"unknown","$value":{}}]`), &decoded), ShouldNotBeNil)
+		})
+	})
+}
+
+type unregistered struct{}
+
+func (unregistered) Area() float64 { return 0 }